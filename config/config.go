@@ -5,22 +5,51 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 )
 
-var Config *model.Config
+var current atomic.Pointer[model.Config]
 var DB *sql.DB
 
+// Current is the loaded config.json. Read it again rather than keeping the
+// pointer, so a reload is seen.
+func Current() *model.Config {
+	return current.Load()
+}
+
 func Startup() {
 	config, err := model.LoadConfig()
 	if err != nil {
 		fmt.Println(err.Error())
 	}
-	Config = config
+	current.Store(config)
+}
+
+// Reload re-reads config.json and passes it to apply, which loads whatever the
+// new config needs and must change nothing when it fails. Only once apply
+// succeeds does the new config become current, so a bad file or key leaves the
+// running config untouched.
+//
+// Only the sections read through Current on each use change without a
+// restart: clients, jwt (applied by main), tls and the token lifetimes.
+// server, database, store, routes, rate_limit, product_cache,
+// response_signing, admin, introspection and trusted_proxies are read once at
+// startup and need a restart.
+func Reload(apply func(next *model.Config) error) error {
+	config, err := model.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if err := apply(config); err != nil {
+		return err
+	}
+	current.Store(config)
+	return nil
 }
 
 func ConnectDB() {
-	configDB := Config.Database
+	configDB := Current().Database
 
 	dsn := fmt.Sprintf(
 		"%s:%s@tcp(%s:%s)/%s?parseTime=true&charset=utf8mb4&loc=Local",
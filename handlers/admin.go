@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"api-gateway/model"
+	"api-gateway/repository"
+	"api-gateway/request"
+	"api-gateway/response"
+	"api-gateway/services"
+	"api-gateway/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler serves the operator endpoints under /admin.
+type AdminHandler struct {
+	tracelog     services.TracelogServices
+	tokenService services.TokenService
+	keys         *utils.KeyRegistry
+	clients      services.ClientService
+	products     services.ProductService
+}
+
+func NewAdminHandler(s services.TracelogServices, t services.TokenService, k *utils.KeyRegistry, cl services.ClientService, p services.ProductService) *AdminHandler {
+	return &AdminHandler{tracelog: s, tokenService: t, keys: k, clients: cl, products: p}
+}
+
+// RevokeClientTokens revokes every token issued to the client so far.
+func (h *AdminHandler) RevokeClientTokens(c *gin.Context) {
+	clientID := c.Param("clientId")
+	if err := h.tokenService.RevokeClient(clientID); err != nil {
+		go h.tracelog.Log("ADMIN REVOKE", clientID, "", "Failed to revoke client tokens: "+err.Error())
+		c.JSON(http.StatusInternalServerError, response.ErrorResponse{ResponseCode: "500", ResponseMessage: "Failed to revoke client tokens."})
+		return
+	}
+	go h.tracelog.Log("ADMIN REVOKE", clientID, "", "All tokens issued to client revoked")
+	c.JSON(http.StatusOK, response.SuccessResponse{ResponseCode: "200", ResponseMessage: "Successful"})
+}
+
+// ListClientKeys shows the fingerprint, or load error, of every client public key.
+func (h *AdminHandler) ListClientKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"keys": h.keys.Status()})
+}
+
+// ListClients shows every client registered in the database.
+func (h *AdminHandler) ListClients(c *gin.Context) {
+	clients, err := h.clients.List()
+	if err != nil {
+		go h.tracelog.Log("ADMIN CLIENT", "", "", "Failed to list clients: "+err.Error())
+		c.JSON(http.StatusInternalServerError, response.ErrorResponse{ResponseCode: "500", ResponseMessage: "Failed to list clients."})
+		return
+	}
+	result := make([]response.ClientResponse, 0, len(clients))
+	for _, client := range clients {
+		res := response.ClientResponse{
+			ClientID:           client.ClientID,
+			Status:             client.Status,
+			SignatureMode:      client.SignatureMode,
+			SignatureAlgorithm: client.SignatureAlgorithm,
+			SignatureHash:      client.SignatureHash,
+			Products:           client.Products,
+			AllowedIPs:         client.AllowedIPs,
+			RatePerSecond:      client.Limits.RatePerSecond,
+			Burst:              client.Limits.Burst,
+			DailyQuota:         client.Limits.DailyQuota,
+			MonthlyQuota:       client.Limits.MonthlyQuota,
+			CreatedAt:          client.CreatedAt,
+			UpdatedAt:          client.UpdatedAt,
+		}
+		if publicKey, err := utils.ParsePublicKeyPEM([]byte(client.PublicKey)); err == nil {
+			res.Fingerprint, _ = utils.KeyFingerprint(publicKey)
+		}
+		result = append(result, res)
+	}
+	c.JSON(http.StatusOK, gin.H{"clients": result})
+}
+
+// CreateClient registers a new partner, active unless suspended later.
+func (h *AdminHandler) CreateClient(c *gin.Context) {
+	var req request.CreateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.ErrorResponse{ResponseCode: "400", ResponseMessage: "Invalid request body: " + err.Error()})
+		return
+	}
+	err := h.clients.Create(model.Client{
+		ClientID:           req.ClientID,
+		PublicKey:          req.PublicKey,
+		SignatureMode:      req.SignatureMode,
+		SignatureAlgorithm: req.SignatureAlgorithm,
+		SignatureHash:      req.SignatureHash,
+		Products:           req.Products,
+		AllowedIPs:         req.AllowedIPs,
+		Limits: model.ClientLimits{
+			RatePerSecond: req.RatePerSecond,
+			Burst:         req.Burst,
+			DailyQuota:    req.DailyQuota,
+			MonthlyQuota:  req.MonthlyQuota,
+		},
+	})
+	if !h.clientChanged(c, req.ClientID, "Client created", err) {
+		return
+	}
+	c.JSON(http.StatusCreated, response.SuccessResponse{ResponseCode: "201", ResponseMessage: "Successful"})
+}
+
+// SuspendClient blocks the client from logging in and revokes its tokens.
+func (h *AdminHandler) SuspendClient(c *gin.Context) {
+	h.setClientStatus(c, services.ClientStatusSuspended)
+}
+
+// ActivateClient lifts a suspension.
+func (h *AdminHandler) ActivateClient(c *gin.Context) {
+	h.setClientStatus(c, services.ClientStatusActive)
+}
+
+func (h *AdminHandler) setClientStatus(c *gin.Context, status string) {
+	clientID := c.Param("clientId")
+	if !h.clientChanged(c, clientID, "Client status set to "+status, h.clients.SetStatus(clientID, status)) {
+		return
+	}
+	if status == services.ClientStatusSuspended {
+		if err := h.tokenService.RevokeClient(clientID); err != nil {
+			go h.tracelog.Log("ADMIN CLIENT", clientID, "", "Failed to revoke tokens of suspended client: "+err.Error())
+			c.JSON(http.StatusInternalServerError, response.ErrorResponse{ResponseCode: "500", ResponseMessage: "Client suspended but its tokens could not be revoked."})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, response.SuccessResponse{ResponseCode: "200", ResponseMessage: "Successful"})
+}
+
+// RotateClientKey replaces the public key the client's signatures are checked with.
+func (h *AdminHandler) RotateClientKey(c *gin.Context) {
+	clientID := c.Param("clientId")
+	var req request.RotateClientKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.ErrorResponse{ResponseCode: "400", ResponseMessage: "Invalid request body: " + err.Error()})
+		return
+	}
+	if !h.clientChanged(c, clientID, "Client key rotated", h.clients.RotateKey(clientID, req.PublicKey)) {
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessResponse{ResponseCode: "200", ResponseMessage: "Successful"})
+}
+
+// clientChanged logs the outcome of a client change, writing the error
+// response when it failed. Key changes are picked up by the registry at once.
+func (h *AdminHandler) clientChanged(c *gin.Context, clientID, message string, err error) bool {
+	switch {
+	case err == nil:
+		go h.tracelog.Log("ADMIN CLIENT", clientID, "", message)
+		h.keys.Refresh()
+		return true
+	case errors.Is(err, services.ErrInvalidClient):
+		c.JSON(http.StatusBadRequest, response.ErrorResponse{ResponseCode: "400", ResponseMessage: err.Error()})
+	case errors.Is(err, services.ErrClientExists):
+		c.JSON(http.StatusConflict, response.ErrorResponse{ResponseCode: "409", ResponseMessage: err.Error()})
+	case errors.Is(err, repository.ErrClientNotFound):
+		c.JSON(http.StatusNotFound, response.ErrorResponse{ResponseCode: "404", ResponseMessage: err.Error()})
+	default:
+		go h.tracelog.Log("ADMIN CLIENT", clientID, "", "Failed to update client: "+err.Error())
+		c.JSON(http.StatusInternalServerError, response.ErrorResponse{ResponseCode: "500", ResponseMessage: "Failed to update client."})
+	}
+	return false
+}
+
+// GrantProduct entitles the client to a product.
+func (h *AdminHandler) GrantProduct(c *gin.Context) {
+	clientID, product := c.Param("clientId"), c.Param("product")
+	if _, ok := h.clients.All()[clientID]; !ok {
+		c.JSON(http.StatusNotFound, response.ErrorResponse{ResponseCode: "404", ResponseMessage: "Client not found."})
+		return
+	}
+	if _, err := h.products.GetProduct(product); err != nil {
+		c.JSON(http.StatusNotFound, response.ErrorResponse{ResponseCode: "404", ResponseMessage: "Product not found."})
+		return
+	}
+	if err := h.products.Grant(product, clientID); err != nil {
+		go h.tracelog.Log("ADMIN ENTITLEMENT", clientID, product, "Failed to grant product: "+err.Error())
+		c.JSON(http.StatusInternalServerError, response.ErrorResponse{ResponseCode: "500", ResponseMessage: "Failed to grant product."})
+		return
+	}
+	go h.tracelog.Log("ADMIN ENTITLEMENT", clientID, product, "Product granted")
+	c.JSON(http.StatusOK, response.SuccessResponse{ResponseCode: "200", ResponseMessage: "Successful"})
+}
+
+// RevokeProduct withdraws a product entitlement. Tokens already issued for it
+// stop working on their next /secure request. Products listed for the client
+// in config.json stay entitled until removed there.
+func (h *AdminHandler) RevokeProduct(c *gin.Context) {
+	clientID, product := c.Param("clientId"), c.Param("product")
+	if err := h.products.Revoke(product, clientID); err != nil {
+		go h.tracelog.Log("ADMIN ENTITLEMENT", clientID, product, "Failed to revoke product: "+err.Error())
+		c.JSON(http.StatusInternalServerError, response.ErrorResponse{ResponseCode: "500", ResponseMessage: "Failed to revoke product."})
+		return
+	}
+	go h.tracelog.Log("ADMIN ENTITLEMENT", clientID, product, "Product revoked")
+	c.JSON(http.StatusOK, response.SuccessResponse{ResponseCode: "200", ResponseMessage: "Successful"})
+}
+
+// ProductCacheStats shows the hit and miss counters of the product cache.
+func (h *AdminHandler) ProductCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.products.CacheStats())
+}
+
+// InvalidateProductCache drops the product given in ?product= from the cache,
+// or the whole cache without it, so master_product changes apply at once.
+func (h *AdminHandler) InvalidateProductCache(c *gin.Context) {
+	product := c.Query("product")
+	h.products.Invalidate(product)
+	go h.tracelog.Log("ADMIN PRODUCT CACHE", "", product, "Product cache invalidated")
+	c.JSON(http.StatusOK, response.SuccessResponse{ResponseCode: "200", ResponseMessage: "Successful"})
+}
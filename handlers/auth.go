@@ -1,82 +1,108 @@
 package handlers
 
 import (
+	"api-gateway/config"
 	"api-gateway/model"
+	"api-gateway/repository"
 	"api-gateway/request"
 	"api-gateway/response"
 	"api-gateway/services"
 	"api-gateway/utils"
-	"crypto"
-	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/x509"
-	"encoding/base64"
-	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AuthHandler struct {
-	tracelog        services.TracelogServices
-	externalIDStore *utils.ExternalIDStore
-	productService  services.ProductService
+	tracelog          services.TracelogServices
+	replayStore       repository.ReplayStore
+	productService    services.ProductService
+	refreshTokenStore repository.RefreshTokenStore
+	tokenService      services.TokenService
+	keys              *utils.KeyRegistry
+	clients           services.ClientService
 }
 
-func NewAuthHandler(s services.TracelogServices, store *utils.ExternalIDStore, p services.ProductService) *AuthHandler {
-	return &AuthHandler{tracelog: s, externalIDStore: store, productService: p}
+func NewAuthHandler(s services.TracelogServices, store repository.ReplayStore, p services.ProductService, r repository.RefreshTokenStore, t services.TokenService, k *utils.KeyRegistry, cl services.ClientService) *AuthHandler {
+	return &AuthHandler{tracelog: s, replayStore: store, productService: p, refreshTokenStore: r, tokenService: t, keys: k, clients: cl}
 }
 
-// --- Core Verification Logic ---
-
-// verifySignature checks if the provided signature is valid for the given data.
-func verifySignature(publicKeyPath, stringToVerify, base64Signature string) error {
-	// 1. Read the public key PEM file
-	publicKeyPEM, err := os.ReadFile(publicKeyPath)
+// checkClient looks up an active client and enforces its allowed IPs and
+// product entitlements, writing the error response when it fails.
+func (h AuthHandler) checkClient(c *gin.Context, proses, clientKey, productType string) (model.ClientConfig, bool) {
+	client, err := h.clients.Get(clientKey)
 	if err != nil {
-		return fmt.Errorf("failed to read public key file: %w", err)
+		message := fmt.Sprintf("Client with key '%s' not registered.", clientKey)
+		if errors.Is(err, services.ErrClientSuspended) {
+			message = fmt.Sprintf("Client with key '%s' is suspended.", clientKey)
+		}
+		go h.tracelog.Log(proses, clientKey, productType, message)
+		c.JSON(http.StatusUnauthorized, response.ErrorResponse{ResponseCode: "401", ResponseMessage: message})
+		return client, false
 	}
-
-	// 2. Decode the PEM block to get the key bytes
-	block, _ := pem.Decode(publicKeyPEM)
-	if block == nil {
-		return errors.New("failed to decode PEM block containing public key")
+	if !client.AllowsIP(c.ClientIP()) {
+		go h.tracelog.Log(proses, clientKey, productType, "Login from IP not allowed: "+c.ClientIP())
+		c.JSON(http.StatusForbidden, response.ErrorResponse{ResponseCode: "403", ResponseMessage: "IP address not allowed for this client."})
+		return client, false
 	}
-
-	// 3. Parse the key bytes into an RSA public key
-	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	entitled, err := h.productService.IsEntitled(productType, clientKey)
 	if err != nil {
-		return fmt.Errorf("failed to parse public key: %w", err)
+		go h.tracelog.Log(proses, clientKey, productType, "Failed to check product entitlement: "+err.Error())
+		c.JSON(http.StatusServiceUnavailable, response.ErrorResponse{ResponseCode: "503", ResponseMessage: "Unable to verify product entitlement, try again later."})
+		return client, false
 	}
-	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
-	if !ok {
-		return errors.New("key is not a valid RSA public key")
+	if !entitled {
+		go h.tracelog.Log(proses, clientKey, productType, "Client not entitled to product")
+		c.JSON(http.StatusForbidden, response.ErrorResponse{ResponseCode: "403", ResponseMessage: "Client is not entitled to this product."})
+		return client, false
 	}
+	return client, true
+}
 
-	signature, err := base64.StdEncoding.DecodeString(base64Signature)
+// --- Core Verification Logic ---
+
+// verifySignature checks if the provided signature is valid for the given data,
+// using the client's cached key and the algorithm and hash configured for it.
+// A client certificate must also be within its validity period and trusted.
+func (h AuthHandler) verifySignature(clientKey, stringToVerify, base64Signature string) error {
+	key, err := h.keys.Get(clientKey)
 	if err != nil {
-		return fmt.Errorf("failed to decode base64 signature: %w", err)
+		return err
 	}
+	if err := key.CheckCertificate(time.Now()); err != nil {
+		return err
+	}
+	return utils.VerifySignatureWith(key.PublicKey, key.Options, stringToVerify, base64Signature)
+}
 
-	// 5. Hash the original data string using SHA256
-	hashed := sha256.Sum256([]byte(stringToVerify))
-
-	// 6. Verify the signature against the hash
-	// This is the core cryptographic operation.
-	err = rsa.VerifyPKCS1v15(rsaPublicKey, crypto.SHA256, hashed[:], signature)
-	if err != nil {
-		// This error means the signature is invalid or tampered with.
-		return errors.New("signature verification failed")
+// Login issues tokens for the grantType in the request body: client_credentials
+// requires a signed login, refresh_token exchanges a refresh token for a new pair.
+func (h AuthHandler) Login(c *gin.Context) {
+	var req request.JwtRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		go h.tracelog.Log("LOGIN", c.GetHeader("X-CLIENT-KEY"), c.GetHeader("X-PRODUCT-ID"), "Invalid request body :"+err.Error())
+		c.JSON(http.StatusBadRequest, response.ErrorResponse{ResponseCode: "400", ResponseMessage: "Invalid request body: " + err.Error()})
+		return
 	}
 
-	return nil // Signature is valid
+	switch req.GrantType {
+	case "client_credentials":
+		h.clientCredentials(c)
+	case "refresh_token":
+		h.refreshToken(c, req)
+	default:
+		go h.tracelog.Log("LOGIN", c.GetHeader("X-CLIENT-KEY"), c.GetHeader("X-PRODUCT-ID"), "Unsupported grantType "+req.GrantType)
+		c.JSON(http.StatusBadRequest, response.ErrorResponse{ResponseCode: "400", ResponseMessage: "Unsupported grantType, expected client_credentials or refresh_token"})
+	}
 }
 
-func (h AuthHandler) Login(c *gin.Context) {
+func (h AuthHandler) clientCredentials(c *gin.Context) {
 	// 1. Extract required headers
 	timestampStr := c.GetHeader("X-TIMESTAMP")
 	clientKey := c.GetHeader("X-CLIENT-KEY")
@@ -95,17 +121,9 @@ func (h AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// 2. Parse request body
-	var req request.JwtRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		go h.tracelog.Log("LOGIN", clientKey, productType, "Invalid request body :"+err.Error())
-		c.JSON(http.StatusBadRequest, response.ErrorResponse{ResponseCode: "400", ResponseMessage: "Invalid request body: " + err.Error()})
-		return
-	}
-
-	// 3. Validate timestamp to prevent replay attacks
-	requestTime, err := time.Parse("2006-01-02T15:04:05-07:00", timestampStr)
-	if err != nil {
+	// 3. Validate timestamp to prevent replay attacks (5-minute window)
+	_, err := utils.ParseTimestamp(timestampStr)
+	if err != nil && !errors.Is(err, utils.ErrTimestampOutOfWindow) {
 		go h.tracelog.Log("LOGIN", clientKey, productType, "Invalid X-TIMESTAMP format")
 		c.JSON(http.StatusBadRequest, response.ErrorResponse{
 			ResponseCode:    "400",
@@ -113,71 +131,224 @@ func (h AuthHandler) Login(c *gin.Context) {
 		})
 		return
 	}
-	// Allow a 5-minute window
-	if time.Since(requestTime).Abs() > 5*time.Minute {
+	if err != nil {
 		go h.tracelog.Log("LOGIN", clientKey, productType, "Request timestamp is too old or too far in the future.")
 		c.JSON(http.StatusUnauthorized, response.ErrorResponse{ResponseCode: "401", ResponseMessage: "Request timestamp is too old or too far in the future."})
 		return
 	}
 
-	// 5. Check if externalID has been seen before
-	if h.externalIDStore.ExistsAndValid(externalID) {
-		h.tracelog.Log("LOGIN", clientKey, externalID, "Replay attack detected: externalID reused")
+	// 5. Find the client and check where it logs in from and for what
+	client, ok := h.checkClient(c, "LOGIN", clientKey, productType)
+	if !ok {
+		return
+	}
+
+	// 6. Verify the digital signature
+	stringToVerify := fmt.Sprintf("%s|%s|%s", clientKey, timestampStr, externalID)
+	err = h.verifySignature(clientKey, stringToVerify, signature)
+	if err != nil {
+		// Log the detailed error for debugging, but return a generic error to the user.
+		go h.tracelog.Log("LOGIN", clientKey, productType, "Invalid Signature :"+err.Error())
+		c.JSON(http.StatusUnauthorized, response.ErrorResponse{ResponseCode: "401", ResponseMessage: "Invalid Signature : " + err.Error()})
+		return
+	}
+
+	// 7. Reserve externalID for this client; fails if it was seen before today.
+	// Only signed requests reserve, so a forged one cannot burn a partner's ID
+	reserved, err := h.replayStore.Reserve(clientKey, externalID, utils.ReplayWindowEnd(time.Now()))
+	if err != nil {
+		go h.tracelog.Log("LOGIN", clientKey, productType, "Replay store error: "+err.Error())
+		c.JSON(http.StatusServiceUnavailable, response.ErrorResponse{ResponseCode: "503", ResponseMessage: "Unable to verify X-EXTERNAL-ID, try again later."})
+		return
+	}
+	if !reserved {
+		go h.tracelog.Log("LOGIN", clientKey, productType, "Replay attack detected: externalID reused "+externalID)
 		c.JSON(http.StatusUnauthorized, response.ErrorResponse{
 			ResponseCode:    "401",
 			ResponseMessage: "Replay attack detected: externalID already used",
 		})
 		return
 	}
-	h.externalIDStore.Save(externalID)
 
-	// 6. Load configuration and find the correct public key
-	config, err := model.LoadConfig()
-	if err != nil {
-		go h.tracelog.Log("LOGIN", clientKey, productType, "Server configuration error.")
-		c.JSON(http.StatusInternalServerError, response.ErrorResponse{ResponseCode: "500", ResponseMessage: "Server configuration error."})
+	// 8. Check the product is active in master_product
+	if !h.checkProduct(c, "LOGIN", clientKey, productType) {
 		return
 	}
-	clientConf, ok := config.Clients[clientKey]
-	if !ok {
-		go h.tracelog.Log("LOGIN", clientKey, productType, fmt.Sprintf("Client with key '%s' not registered.", clientKey))
-		c.JSON(http.StatusUnauthorized, response.ErrorResponse{ResponseCode: "401", ResponseMessage: fmt.Sprintf("Client with key '%s' not registered.", clientKey)})
+
+	// 9. Jika signature valid dan product aktif, maka generate jwt
+	h.issueTokens(c, "LOGIN", client, clientKey, productType, externalID, "")
+}
+
+func (h AuthHandler) refreshToken(c *gin.Context, req request.JwtRequest) {
+	clientKey := c.GetHeader("X-CLIENT-KEY")
+	externalID := c.GetHeader("X-EXTERNAL-ID")
+
+	// 1. Verify the refresh token itself
+	if clientKey == "" || req.RefreshToken == "" {
+		go h.tracelog.Log("REFRESH", clientKey, "", "Missing X-CLIENT-KEY or refreshToken")
+		c.JSON(http.StatusBadRequest, response.ErrorResponse{ResponseCode: "400", ResponseMessage: "Missing Required X-CLIENT-KEY header or refreshToken"})
 		return
 	}
+	claims, err := h.tokenService.Verify(req.RefreshToken)
+	if err != nil || claims.Type != "refresh" || claims.Subject != clientKey {
+		go h.tracelog.Log("REFRESH", clientKey, "", "Invalid refresh token")
+		c.JSON(http.StatusUnauthorized, response.ErrorResponse{ResponseCode: "401", ResponseMessage: "Invalid refresh token"})
+		return
+	}
+	productType := claims.Product
 
-	// 7. Verify the digital signature
-	stringToVerify := fmt.Sprintf("%s|%s|%s", clientKey, timestampStr, externalID)
-	err = verifySignature(clientConf.PublicKeyPath, stringToVerify, signature)
-	if err != nil {
-		// Log the detailed error for debugging, but return a generic error to the user.
-		go h.tracelog.Log("LOGIN", clientKey, productType, "Invalid Signature :"+err.Error())
-		fmt.Printf("Signature verification failed for client %s: %v\n", clientKey, err)
-		c.JSON(http.StatusUnauthorized, response.ErrorResponse{ResponseCode: "401", ResponseMessage: "Invalid Signature : " + err.Error()})
+	// 2. Consume it; presenting a used token revokes the refresh tokens of the
+	// login, its access tokens run until they expire
+	if err := h.refreshTokenStore.Use(claims.ID); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRefreshTokenReused):
+			go h.tracelog.Log("REFRESH", clientKey, productType, "Refresh token reuse detected, family "+claims.Family+" revoked")
+		case errors.Is(err, repository.ErrRefreshTokenUnknown), errors.Is(err, repository.ErrRefreshTokenRevoked):
+			go h.tracelog.Log("REFRESH", clientKey, productType, err.Error())
+		default:
+			go h.tracelog.Log("REFRESH", clientKey, productType, "Failed to check refresh token: "+err.Error())
+			c.JSON(http.StatusServiceUnavailable, response.ErrorResponse{ResponseCode: "503", ResponseMessage: "Unable to verify refresh token, try again later."})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, response.ErrorResponse{ResponseCode: "401", ResponseMessage: "Invalid refresh token"})
 		return
 	}
 
-	// 8. Check product main/engga lewat master_product
-	recid, err := h.productService.IsProductMain(productType, clientKey)
-	if !recid || err != nil {
-		go h.tracelog.Log("LOGIN", clientKey, productType, err.Error())
-		c.JSON(http.StatusBadRequest, response.ErrorResponse{ResponseCode: "400", ResponseMessage: err.Error()})
+	// 3. The client and product must still be allowed to get tokens
+	client, ok := h.checkClient(c, "REFRESH", clientKey, productType)
+	if !ok {
+		return
+	}
+	if !h.checkProduct(c, "REFRESH", clientKey, productType) {
 		return
 	}
 
-	// 9. Jika signature valid dan product main, maka generate jwt
-	accessToken, err := utils.GenerateJWT(clientKey)
+	// 4. Rotate: new access token and a new refresh token in the same family
+	h.issueTokens(c, "REFRESH", client, clientKey, productType, externalID, claims.Family)
+}
+
+// checkProduct writes the error response for a product that is unknown or not
+// active: 404, or the state's status code with the partner facing message.
+func (h AuthHandler) checkProduct(c *gin.Context, proses, clientKey, productType string) bool {
+	err := h.productService.CheckAvailability(productType, clientKey)
+	var unavailable *services.ProductUnavailableError
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrProductNotFound):
+		go h.tracelog.Log(proses, clientKey, productType, "Product not found")
+		c.JSON(http.StatusNotFound, response.ErrorResponse{ResponseCode: "404", ResponseMessage: "Product not found."})
+	case errors.As(err, &unavailable):
+		go h.tracelog.Log(proses, clientKey, productType, unavailable.Error())
+		if seconds := unavailable.RetryAfterSeconds(); seconds > 0 {
+			c.Header("Retry-After", strconv.Itoa(seconds))
+		}
+		status := unavailable.HTTPStatus()
+		c.JSON(status, response.ErrorResponse{ResponseCode: strconv.Itoa(status), ResponseMessage: unavailable.Message})
+	default:
+		go h.tracelog.Log(proses, clientKey, productType, "Failed to read product: "+err.Error())
+		c.JSON(http.StatusServiceUnavailable, response.ErrorResponse{ResponseCode: "503", ResponseMessage: "Unable to verify product, try again later."})
+	}
+	return false
+}
+
+// issueTokens writes an access and refresh token pair as the success response,
+// using the lifetimes configured for the client.
+func (h AuthHandler) issueTokens(c *gin.Context, proses string, client model.ClientConfig, clientKey, productType, externalID, family string) {
+	cfg := config.Current()
+	accessToken, accessClaims, err := utils.GenerateJWT(clientKey, productType, externalID, client.Scopes, cfg.AccessTokenTTL(client))
 	if err != nil {
-		go h.tracelog.Log("LOGIN", clientKey, productType, "Failed to generate access token.")
+		go h.tracelog.Log(proses, clientKey, productType, "Failed to generate access token.")
 		c.JSON(http.StatusInternalServerError, response.ErrorResponse{ResponseCode: "500", ResponseMessage: "Failed to generate access token."})
 		return
 	}
+	refreshToken, refreshClaims, err := utils.GenerateRefreshJWT(clientKey, productType, family, cfg.RefreshTokenTTL(client))
+	if err != nil {
+		go h.tracelog.Log(proses, clientKey, productType, "Failed to generate refresh token.")
+		c.JSON(http.StatusInternalServerError, response.ErrorResponse{ResponseCode: "500", ResponseMessage: "Failed to generate refresh token."})
+		return
+	}
+	if err := h.refreshTokenStore.Issue(refreshClaims.ID, refreshClaims.Family, refreshClaims.ExpiresAt.Time); err != nil {
+		go h.tracelog.Log(proses, clientKey, productType, "Failed to record refresh token: "+err.Error())
+		c.JSON(http.StatusInternalServerError, response.ErrorResponse{ResponseCode: "500", ResponseMessage: "Failed to generate refresh token."})
+		return
+	}
 
-	// 10. Login sukses, generate JWT
-	go h.tracelog.Log("LOGIN", clientKey, productType, "Success generate accesstoken :"+accessToken)
+	go h.tracelog.Log(proses, clientKey, productType, "Success generate accesstoken, jti "+accessClaims.ID+", refresh family "+refreshClaims.Family)
 	c.JSON(http.StatusOK, response.SuccessResponse{ResponseCode: "200", ResponseMessage: "Successful", AdditionalInfo: map[string]string{
-		"accessToken": accessToken,
-		"tokenType":   "Bearer",
-		"expiresIn":   "900",
+		"accessToken":           accessToken,
+		"tokenType":             "Bearer",
+		"expiresIn":             strconv.Itoa(int(accessClaims.Lifetime().Seconds())),
+		"refreshToken":          refreshToken,
+		"refreshTokenExpiresIn": strconv.Itoa(int(refreshClaims.Lifetime().Seconds())),
 	},
 	})
 }
+
+// Logout revokes the access token of the request and, when given, the refresh
+// token family it was issued with.
+func (h AuthHandler) Logout(c *gin.Context) {
+	claims, ok := utils.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, response.ErrorResponse{ResponseCode: "401", ResponseMessage: "Missing access token claims"})
+		return
+	}
+
+	var req request.LogoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, response.ErrorResponse{ResponseCode: "400", ResponseMessage: "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if err := h.tokenService.Revoke(claims); err != nil {
+		go h.tracelog.Log("LOGOUT", claims.Subject, claims.Product, "Failed to revoke access token: "+err.Error())
+		c.JSON(http.StatusInternalServerError, response.ErrorResponse{ResponseCode: "500", ResponseMessage: "Failed to revoke access token."})
+		return
+	}
+	if req.RefreshToken != "" {
+		refreshClaims, err := utils.VerifyJWT(req.RefreshToken)
+		if err == nil && refreshClaims.Type == "refresh" && refreshClaims.Subject == claims.Subject {
+			if err := h.refreshTokenStore.RevokeFamily(refreshClaims.Family); err != nil {
+				go h.tracelog.Log("LOGOUT", claims.Subject, claims.Product, "Failed to revoke refresh tokens: "+err.Error())
+				c.JSON(http.StatusInternalServerError, response.ErrorResponse{ResponseCode: "500", ResponseMessage: "Failed to revoke refresh token."})
+				return
+			}
+		}
+	}
+
+	go h.tracelog.Log("LOGOUT", claims.Subject, claims.Product, "Access token revoked :"+claims.ID)
+	c.JSON(http.StatusOK, response.SuccessResponse{ResponseCode: "200", ResponseMessage: "Successful"})
+}
+
+// Introspect reports whether a token is active (RFC 7662), applying the same
+// checks as JWTAuthMiddleware. Callers authenticate as service clients.
+func (h AuthHandler) Introspect(c *gin.Context) {
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "token is required"})
+		return
+	}
+
+	claims, err := h.tokenService.VerifyAccess(token)
+	if err != nil {
+		go h.tracelog.Log("INTROSPECT", c.GetString("serviceClient"), "", "Inactive token: "+err.Error())
+		c.JSON(http.StatusOK, response.IntrospectionResponse{Active: false})
+		return
+	}
+
+	go h.tracelog.Log("INTROSPECT", c.GetString("serviceClient"), claims.Product, "Active token :"+claims.ID)
+	c.JSON(http.StatusOK, response.IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(claims.Scopes, " "),
+		ClientID:  claims.Subject,
+		TokenType: "Bearer",
+		Exp:       claims.ExpiresAt.Unix(),
+		Iat:       claims.IssuedAt.Unix(),
+		Nbf:       claims.NotBefore.Unix(),
+		Sub:       claims.Subject,
+		Aud:       claims.Audience,
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+		Product:   claims.Product,
+	})
+}
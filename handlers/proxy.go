@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"api-gateway/middleware"
 	"api-gateway/services"
+	"api-gateway/utils"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,12 +18,17 @@ import (
 
 // ProxyHandler holds dependencies for the proxy logic.
 type ProxyHandler struct {
-	tracelog services.TracelogServices
+	tracelog       services.TracelogServices
+	routes         services.RouteService
+	responseSigner services.ResponseSigningService
+	upstreams      services.UpstreamService
+	maxSignedBody  int64
 }
 
-// NewProxyHandler creates a new instance of the proxy handler.
-func NewProxyHandler(s services.TracelogServices) *ProxyHandler {
-	return &ProxyHandler{tracelog: s}
+// NewProxyHandler creates a new instance of the proxy handler. Responses signed
+// for the partner are buffered up to maxSignedBody bytes.
+func NewProxyHandler(s services.TracelogServices, r services.RouteService, rs services.ResponseSigningService, u services.UpstreamService, maxSignedBody int64) *ProxyHandler {
+	return &ProxyHandler{tracelog: s, routes: r, responseSigner: rs, upstreams: u, maxSignedBody: maxSignedBody}
 }
 
 // buildRequestLogString constructs a single string containing all relevant request details.
@@ -70,15 +79,37 @@ func (h *ProxyHandler) buildResponseLogString(respBody []byte) string {
 
 // ProxyHandler forwards the request after logging its contents.
 func (h *ProxyHandler) ProxyHandler(c *gin.Context) {
-	targetURL := c.Query("target")
-	if targetURL == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'target' query parameter"})
+	claims, ok := utils.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing access token claims"})
+		return
+	}
+
+	route, ok := middleware.GetRoute(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": services.ErrRouteNotFound.Error()})
+		return
+	}
+	for _, scope := range route.Scopes {
+		if !claims.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access token is missing scope " + scope})
+			return
+		}
+	}
+
+	productType := claims.Product
+	targetURL, err := h.routes.TargetURL(route, productType, c.Param("proxyPath"), c.Request.URL.Query())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrTargetNotAllowed) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
 	// --- LOGGING INCOMING REQUEST ---
-	clientKey := c.GetHeader("X-PARTNER-ID")
-	productType := c.GetHeader("X-EXTERNAL-ID")
+	clientKey := claims.Subject
 	requestLogStr := h.buildRequestLogString(c, targetURL)
 	go h.tracelog.Log("REQUEST", clientKey, productType, requestLogStr)
 	// --- END REQUEST LOGGING ---
@@ -86,32 +117,64 @@ func (h *ProxyHandler) ProxyHandler(c *gin.Context) {
 	// --- PROXY LOGIC ---
 	cachedBody, exists := c.Get("cachedBody")
 	var requestBody io.Reader
+	var bodyBytes []byte
 	if exists {
-		requestBody = bytes.NewBuffer(cachedBody.([]byte))
+		bodyBytes = cachedBody.([]byte)
+		requestBody = bytes.NewBuffer(bodyBytes)
 	} else {
 		requestBody = c.Request.Body // Fallback for GET requests etc.
 	}
 
-	req, err := http.NewRequest(c.Request.Method, targetURL, requestBody)
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, targetURL, requestBody)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create proxy request"})
 		return
 	}
 
-	req.Header = c.Request.Header
+	req.Header = c.Request.Header.Clone()
 	req.Header.Del("Host")
 	req.Host = ""
+	if h.responseSigner.Enabled(clientKey) {
+		// Signed bodies must be the decoded bytes the partner verifies; without
+		// the partner's header the transport negotiates and decompresses itself
+		req.Header.Del("Accept-Encoding")
+	}
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	if err := h.upstreams.Authenticate(req, route, claims, bodyBytes); err != nil {
+		go h.tracelog.Log("REQUEST", clientKey, productType, "Failed to authenticate to upstream: "+err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create proxy request"})
+		return
+	}
+	client, err := h.upstreams.Client(route)
+	if err != nil {
+		go h.tracelog.Log("REQUEST", clientKey, productType, "Failed to configure upstream client: "+err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create proxy request"})
+		return
+	}
+	release, err := h.upstreams.Acquire(c.Request.Context(), route, req.URL)
+	if err != nil {
+		go h.tracelog.Log("REQUEST", clientKey, productType, "Upstream request shed: "+err.Error())
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Target server is busy, try again later"})
+		return
 	}
+	start := time.Now()
 	resp, err := client.Do(req)
+	latency := time.Since(start)
 	if err != nil {
+		// A partner hanging up says nothing about the upstream's health
+		release(latency, !errors.Is(err, context.Canceled))
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to reach target server", "details": err.Error()})
 		return
 	}
+	defer release(latency, resp.StatusCode >= http.StatusInternalServerError)
 	defer resp.Body.Close()
 
+	if h.responseSigner.Enabled(clientKey) {
+		h.writeSignedResponse(c, resp, clientKey, productType)
+		return
+	}
+
 	// --- LOGGING OUTGOING RESPONSE ---
 	// Use a buffer to capture the response body as it's being streamed back to the client.
 	var respBodyBuffer bytes.Buffer
@@ -133,3 +196,36 @@ func (h *ProxyHandler) ProxyHandler(c *gin.Context) {
 	go h.tracelog.Log("RESPONSE", clientKey, productType, responseLogStr)
 	// --- END RESPONSE LOGGING ---
 }
+
+// writeSignedResponse buffers the upstream body so X-SIGNATURE and X-TIMESTAMP
+// can be sent as headers ahead of it.
+func (h *ProxyHandler) writeSignedResponse(c *gin.Context, resp *http.Response, clientKey, productType string) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, h.maxSignedBody+1))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to read target server response", "details": err.Error()})
+		return
+	}
+	if int64(len(body)) > h.maxSignedBody {
+		go h.tracelog.Log("RESPONSE", clientKey, productType, "Response too large to sign")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Target server response too large to sign"})
+		return
+	}
+
+	timestamp := time.Now().Format(utils.TimestampLayout)
+	signature, err := h.responseSigner.Sign(clientKey, c.Request.Method, c.Request.URL.Path, body, timestamp)
+	if err != nil {
+		go h.tracelog.Log("RESPONSE", clientKey, productType, "Failed to sign response: "+err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to sign response"})
+		return
+	}
+
+	for k, v := range resp.Header {
+		c.Writer.Header()[k] = v
+	}
+	c.Writer.Header().Set("X-SIGNATURE", signature)
+	c.Writer.Header().Set("X-TIMESTAMP", timestamp)
+	c.Writer.WriteHeader(resp.StatusCode)
+	c.Writer.Write(body)
+
+	go h.tracelog.Log("RESPONSE", clientKey, productType, h.buildResponseLogString(body))
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"api-gateway/config"
+	"api-gateway/model"
 	"api-gateway/routes"
+	"api-gateway/utils"
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -25,24 +28,81 @@ func main() {
 	config.Startup()
 	config.ConnectDB()
 
+	// Client IPs feed the login allowlist and rate limits, so X-Forwarded-For
+	// is only honoured from the proxies in front of the gateway
+	if err := r.SetTrustedProxies(config.Current().TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted_proxies: %v", err)
+	}
+
 	routes.RegisterRoutes(r, config.DB)
 
 	// Create the HTTP server
 	srv := &http.Server{
-		Addr:    ":" + config.Config.Server["port"].(string),
+		Addr:    ":" + config.Current().Server["port"].(string),
 		Handler: r,
 	}
+	var tlsReloader *utils.TLSReloader
+	if config.Current().TLS.Enabled {
+		var err error
+		tlsReloader, err = utils.NewTLSReloader(func() model.TLSConfig { return config.Current().TLS })
+		if err != nil {
+			log.Fatalf("TLS setup failed: %v", err)
+		}
+		tlsReloader.Watch(30 * time.Second)
+		srv.TLSConfig = tlsReloader.TLSConfig()
+	}
 	r.GET("/healthz", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
+		health := gin.H{"status": "ok"}
+		if tlsReloader != nil {
+			health["certificateNotAfter"] = tlsReloader.NotAfter().Format(time.RFC3339)
+		}
+		c.JSON(200, health)
 	})
 
 	// Start the server in a goroutine
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("listen: %s\n", err)
 		}
 	}()
 
+	// Reload config.json and rotate JWT keys on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			// The JWT keys are loaded and checked before anything is swapped,
+			// then switched together with the config
+			err := config.Reload(func(next *model.Config) error {
+				keys, err := utils.ParseSigningKeys(next.JWT)
+				if err != nil {
+					return fmt.Errorf("jwt keys: %w", err)
+				}
+				utils.UseSigningKeys(keys)
+				utils.ConfigureJWT(next.JWT.Issuer, next.JWT.Audience)
+				return nil
+			})
+			if err != nil {
+				log.Printf("Config reload failed, keeping current config and keys: %v", err)
+				continue
+			}
+			log.Println("Config and JWT keys reloaded")
+			if tlsReloader != nil {
+				if err := tlsReloader.Reload(); err != nil {
+					log.Printf("TLS certificate reload failed, keeping current certificate: %v", err)
+				} else {
+					log.Println("TLS certificate reloaded")
+				}
+			}
+		}
+	}()
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
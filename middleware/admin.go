@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuthMiddleware only lets requests through that carry one of apiKeys in X-ADMIN-KEY.
+func AdminAuthMiddleware(apiKeys []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-ADMIN-KEY")
+		if key != "" {
+			for _, k := range apiKeys {
+				if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+					c.Next()
+					return
+				}
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Admin Key"})
+	}
+}
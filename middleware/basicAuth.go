@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BasicAuthMiddleware authenticates service clients with HTTP Basic credentials
+// and stores the username under "serviceClient".
+func BasicAuthMiddleware(accounts map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, password, ok := c.Request.BasicAuth()
+		expected, known := accounts[user]
+		if !ok || !known || subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+			c.Header("WWW-Authenticate", `Basic realm="api-gateway"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+			return
+		}
+		c.Set("serviceClient", user)
+		c.Next()
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"api-gateway/model"
+	"api-gateway/utils"
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientCertKey is the context key of the partner identified by its TLS client certificate.
+const ClientCertKey = "clientCertPartner"
+
+// ClientCertMiddleware maps a verified TLS client certificate to the partner
+// whose tls_fingerprint (hex SHA-256 of the SPKI) or tls_subject matches it,
+// and rejects requests whose X-CLIENT-KEY or X-PARTNER-ID names anyone else.
+// Partners with require_mtls must present a certificate.
+func ClientCertMiddleware(clients func() map[string]model.ClientConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claimed := []string{c.GetHeader("X-CLIENT-KEY"), c.GetHeader("X-PARTNER-ID")}
+
+		var cert *x509.Certificate
+		if tlsState := c.Request.TLS; tlsState != nil && len(tlsState.VerifiedChains) > 0 {
+			cert = tlsState.VerifiedChains[0][0]
+		}
+		if cert == nil {
+			for _, clientID := range claimed {
+				if clientID != "" && clients()[clientID].RequireMTLS {
+					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Client certificate required"})
+					return
+				}
+			}
+			c.Next()
+			return
+		}
+
+		partner, ok := partnerForCertificate(cert, clients())
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Client certificate not registered"})
+			return
+		}
+		for _, clientID := range claimed {
+			if clientID != "" && clientID != partner {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Client certificate does not match partner"})
+				return
+			}
+		}
+		c.Set(ClientCertKey, partner)
+		c.Next()
+	}
+}
+
+func partnerForCertificate(cert *x509.Certificate, clients map[string]model.ClientConfig) (string, bool) {
+	fingerprint, err := utils.KeyFingerprint(cert.PublicKey)
+	if err != nil {
+		return "", false
+	}
+	subject := cert.Subject.String()
+	for clientID, conf := range clients {
+		if conf.TLSFingerprint != "" && strings.EqualFold(strings.ReplaceAll(conf.TLSFingerprint, ":", ""), fingerprint) {
+			return clientID, true
+		}
+		if conf.TLSSubject != "" && conf.TLSSubject == subject {
+			return clientID, true
+		}
+	}
+	return "", false
+}
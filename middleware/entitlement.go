@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"api-gateway/services"
+	"api-gateway/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EntitlementMiddleware rechecks on every request that the token's client is
+// still entitled to the product it was issued for. It runs after JWTAuthMiddleware.
+func EntitlementMiddleware(tracelog services.TracelogServices, products services.ProductService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := utils.GetClaims(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
+			return
+		}
+		entitled, err := products.IsEntitled(claims.Product, claims.Subject)
+		if err != nil {
+			go tracelog.Log("ENTITLEMENT", claims.Subject, claims.Product, "Failed to check product entitlement: "+err.Error())
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to verify product entitlement"})
+			return
+		}
+		if !entitled {
+			go tracelog.Log("ENTITLEMENT", claims.Subject, claims.Product, "Client not entitled to product")
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Client is not entitled to this product"})
+			return
+		}
+		c.Next()
+	}
+}
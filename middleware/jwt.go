@@ -1,23 +1,25 @@
 package middleware
 
 import (
+	"api-gateway/services"
 	"api-gateway/utils"
-	"fmt"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func JWTAuthMiddleware() gin.HandlerFunc {
+// JWTAuthMiddleware verifies the access token and the transaction headers: the
+// X-TIMESTAMP window, X-PARTNER-ID matching the token and X-EXTERNAL-ID being
+// present. SecureProxy checks that the external ID is unused.
+func JWTAuthMiddleware(tokens services.TokenService) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 		timestamp := c.GetHeader("X-TIMESTAMP")
 		authHeader := c.GetHeader("Authorization")
 		clientID := c.GetHeader("X-PARTNER-ID")
 		externalID := c.GetHeader("X-EXTERNAL-ID")
-		// signature := c.GetHeader("X-SIGNATURE")
-		fmt.Println(timestamp, authHeader, clientID, externalID)
 
 		if timestamp == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing Timestamp"})
@@ -31,6 +33,10 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing ExternalID"})
 			return
 		}
+		if _, err := utils.ParseTimestamp(timestamp); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Timestamp: " + err.Error()})
+			return
+		}
 		// if signature == "" {
 		// 	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing Access Token"})
 		// 	return
@@ -46,11 +52,22 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 		tokenString := parts[1]
-		_, err := utils.VerifyJWT(tokenString)
+		claims, err := tokens.VerifyAccess(tokenString)
+		if errors.Is(err, services.ErrTokenRevoked) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Access Token Revoked"})
+			return
+		}
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Access Token"})
 			return
 		}
+		if claims.Subject != clientID {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "X-PARTNER-ID does not match Access Token"})
+			return
+		}
+
+		// Handlers read the partner and product from the token, never from request headers
+		c.Set(utils.ClaimsKey, claims)
 		c.Next()
 	}
 }
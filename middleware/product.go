@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"api-gateway/services"
+	"api-gateway/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProductAvailabilityMiddleware stops requests for products that are not
+// active: 404 for unknown products, 503 with Retry-After during maintenance,
+// 403 when suspended and 410 once retired. It runs after JWTAuthMiddleware.
+func ProductAvailabilityMiddleware(products services.ProductService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := utils.GetClaims(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
+			return
+		}
+		err := products.CheckAvailability(claims.Product, claims.Subject)
+		var unavailable *services.ProductUnavailableError
+		switch {
+		case err == nil:
+			c.Next()
+		case errors.Is(err, services.ErrProductNotFound):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		case errors.As(err, &unavailable):
+			if seconds := unavailable.RetryAfterSeconds(); seconds > 0 {
+				c.Header("Retry-After", strconv.Itoa(seconds))
+			}
+			c.AbortWithStatusJSON(unavailable.HTTPStatus(), gin.H{"error": unavailable.Message, "state": unavailable.State})
+		default:
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to verify product"})
+		}
+	}
+}
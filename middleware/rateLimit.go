@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"api-gateway/services"
+	"api-gateway/utils"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoginRateLimitMiddleware throttles /auth/login per source IP.
+func LoginRateLimitMiddleware(limiter services.RateLimitService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		decision, err := limiter.CheckLogin(c.ClientIP())
+		applyRateLimit(c, decision, err)
+	}
+}
+
+// ClientRateLimitMiddleware throttles /secure per client and route and counts
+// the client's quotas. It runs after JWTAuthMiddleware and RouteMiddleware.
+func ClientRateLimitMiddleware(limiter services.RateLimitService, clients services.ClientService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := utils.GetClaims(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
+			return
+		}
+		route, _ := GetRoute(c)
+		decision, err := limiter.CheckClient(claims.Subject, clients.All()[claims.Subject].Limits, route)
+		applyRateLimit(c, decision, err)
+	}
+}
+
+// limiterFailures logs at most one limiter error a minute, so a database
+// outage does not add a log line to every request.
+var limiterFailures = &throttledLog{interval: time.Minute}
+
+type throttledLog struct {
+	mu         sync.Mutex
+	interval   time.Duration
+	last       time.Time
+	suppressed int
+}
+
+func (l *throttledLog) Printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now := time.Now(); now.Sub(l.last) >= l.interval {
+		if l.suppressed > 0 {
+			format += " (" + strconv.Itoa(l.suppressed) + " similar errors suppressed)"
+		}
+		log.Printf(format, args...)
+		l.last, l.suppressed = now, 0
+		return
+	}
+	l.suppressed++
+}
+
+// applyRateLimit sets the X-RateLimit-* headers and answers 429 with
+// Retry-After when the request is over a limit. Requests are let through when
+// the limiter itself fails, so a database hiccup does not take the gateway down.
+func applyRateLimit(c *gin.Context, decision services.RateLimitDecision, err error) {
+	if err != nil {
+		limiterFailures.Printf("Rate limiter unavailable, request not limited: %v", err)
+		c.Next()
+		return
+	}
+	if decision.Limit > 0 {
+		c.Header("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+	}
+	if !decision.Allowed {
+		c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(decision.RetryAfter), 1)))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too Many Requests"})
+		return
+	}
+	c.Next()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
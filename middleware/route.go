@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"api-gateway/model"
+	"api-gateway/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteKey is the gin context key RouteMiddleware stores the matched route under.
+const RouteKey = "route"
+
+// RouteMiddleware matches /secure/*proxyPath against the route table so later
+// middleware can apply per route settings.
+func RouteMiddleware(routes services.RouteService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route, err := routes.Match(c.Request.Method, c.Param("proxyPath"))
+		if err != nil {
+			status := http.StatusNotFound
+			if errors.Is(err, services.ErrMethodNotAllowed) {
+				status = http.StatusMethodNotAllowed
+			}
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(RouteKey, route)
+		c.Next()
+	}
+}
+
+// GetRoute returns the route RouteMiddleware matched for this request.
+func GetRoute(c *gin.Context) (*model.RouteConfig, bool) {
+	value, ok := c.Get(RouteKey)
+	if !ok {
+		return nil, false
+	}
+	route, ok := value.(*model.RouteConfig)
+	return route, ok
+}
@@ -1,112 +1,129 @@
 package middleware
 
 import (
-	"bytes"
+	"api-gateway/model"
+	"api-gateway/repository"
+	"api-gateway/services"
+	"api-gateway/utils"
 	"crypto/hmac"
-	"crypto/sha256"
-	"crypto/sha512"
-	"encoding/base64"
-	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func SecureProxy() gin.HandlerFunc {
+// SecureProxy verifies the SNAP style transaction signature over
+// METHOD:path:token:sha256(body):timestamp, as HMAC-SHA512 with a client secret
+// or, for clients in asymmetric mode, with the client's public key. The mode
+// comes from the client's settings: an asymmetric client whose key cannot be
+// loaded is rejected, never checked against HMAC secrets. It runs after
+// JWTAuthMiddleware, BodyCacheMiddleware and RouteMiddleware; routes with
+// skip_signature bypass the signature check.
+//
+// As the last check before the proxy it then reserves X-EXTERNAL-ID, so a
+// request rejected by any earlier check does not use up its external ID.
+func SecureProxy(tracelog services.TracelogServices, secrets services.ClientSecretService, keys *utils.KeyRegistry, clients func() map[string]model.ClientConfig, replay repository.ReplayStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		timestamp := c.GetHeader("X-TIMESTAMP")
-		clientSignatureB64 := c.GetHeader("X-SIGNATURE")
-
-		if authHeader == "" || timestamp == "" || clientSignatureB64 == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing required headers (Authorization, X-TIMESTAMP, X-SIGNATURE)"})
-			return
-		}
-
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Authorization header format"})
-			return
+		if route, ok := GetRoute(c); !ok || !route.SkipSignature {
+			if !verifySignature(c, tracelog, secrets, keys, clients) {
+				return
+			}
 		}
-		accessToken := parts[1]
 
-		var bodyBytes []byte
-		if c.Request.Body != nil {
-			bodyBytes, _ = io.ReadAll(c.Request.Body)
-		}
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-		minifiedBody := minifyJSON(bodyBytes)
-		bodyHash := sha256.Sum256([]byte(minifiedBody))
-		encodedBody := strings.ToLower(hex.EncodeToString(bodyHash[:]))
-
-		httpMethod := c.Request.Method
-		endpointURL := c.Request.URL.Path
-		stringToSign := fmt.Sprintf("%s:%s:%s:%s:%s", httpMethod, endpointURL, accessToken, encodedBody, timestamp)
-
-		token, _, err := new(jwt.Parser).ParseUnverified(accessToken, jwt.MapClaims{})
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
-			return
-		}
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Could not parse token claims"})
-			return
-		}
-		clientID, ok := claims["sub"].(string)
+		// The token was verified by JWTAuthMiddleware, so its subject can be trusted
+		claims, ok := utils.GetClaims(c)
 		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Client ID not found in token"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
 			return
 		}
-
-		clientSecret, err := getClientSecret(clientID)
+		reserved, err := replay.Reserve(claims.Subject, c.GetHeader("X-EXTERNAL-ID"), utils.ReplayWindowEnd(time.Now()))
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Client not registered or secret not found"})
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to verify ExternalID"})
 			return
 		}
-
-		mac := hmac.New(sha512.New, []byte(clientSecret))
-		mac.Write([]byte(stringToSign))
-		expectedSignature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
-
-		if !hmac.Equal([]byte(expectedSignature), []byte(clientSignatureB64)) {
-			fmt.Printf("Signature Mismatch!\nClient Sent: %s\nServer Expected: %s\nString Signed: %s\n", clientSignatureB64, expectedSignature, stringToSign)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Signature"})
+		if !reserved {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "ExternalID already used"})
 			return
 		}
-
 		c.Next()
 	}
 }
 
-func getClientSecret(clientID string) (string, error) {
-	// Example static mapping for demonstration purposes.
-	secrets := map[string]string{
-		"C00001": "super-secret-for-client-001",
-		"C00002": "another-secret-for-client-002",
+// verifySignature checks X-SIGNATURE, aborting the request when it is invalid.
+func verifySignature(c *gin.Context, tracelog services.TracelogServices, secrets services.ClientSecretService, keys *utils.KeyRegistry, clients func() map[string]model.ClientConfig) bool {
+	authHeader := c.GetHeader("Authorization")
+	timestamp := c.GetHeader("X-TIMESTAMP")
+	clientSignatureB64 := c.GetHeader("X-SIGNATURE")
+
+	if authHeader == "" || timestamp == "" || clientSignatureB64 == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing required headers (Authorization, X-TIMESTAMP, X-SIGNATURE)"})
+		return false
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Authorization header format"})
+		return false
+	}
+	accessToken := parts[1]
+
+	var bodyBytes []byte
+	if cachedBody, exists := c.Get("cachedBody"); exists {
+		bodyBytes = cachedBody.([]byte)
 	}
-	secret, ok := secrets[clientID]
+
+	encodedBody := utils.BodyDigest(bodyBytes)
+
+	httpMethod := c.Request.Method
+	endpointURL := c.Request.URL.Path
+	stringToSign := fmt.Sprintf("%s:%s:%s:%s:%s", httpMethod, endpointURL, accessToken, encodedBody, timestamp)
+
+	claims, ok := utils.GetClaims(c)
 	if !ok {
-		return "", fmt.Errorf("client secret for '%s' not found", clientID)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
+		return false
 	}
-	return secret, nil
-}
+	clientID := claims.Subject
+	// The string to sign holds the bearer token, so only its public parts are logged
+	mismatch := fmt.Sprintf("Signature mismatch | Method: %s | Path: %s | Timestamp: %s", httpMethod, endpointURL, timestamp)
 
-func minifyJSON(jsonBytes []byte) string {
-	buffer := new(bytes.Buffer)
-	if err := json.Compact(buffer, jsonBytes); err != nil {
-		s := string(jsonBytes)
-		s = strings.ReplaceAll(s, " ", "")
-		s = strings.ReplaceAll(s, "\n", "")
-		s = strings.ReplaceAll(s, "\r", "")
-		s = strings.ReplaceAll(s, "\t", "")
-		return s
+	if clients()[clientID].SignatureMode == "asymmetric" {
+		key, err := keys.Get(clientID)
+		if err != nil {
+			go tracelog.Log("SIGNATURE", clientID, claims.Product, "Client public key unavailable: "+err.Error())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Client public key unavailable"})
+			return false
+		}
+		if err := key.CheckCertificate(time.Now()); err != nil {
+			go tracelog.Log("SIGNATURE", clientID, claims.Product, "Client certificate rejected: "+err.Error())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Client certificate rejected"})
+			return false
+		}
+		if err := utils.VerifySignatureWith(key.PublicKey, key.Options, stringToSign, clientSignatureB64); err != nil {
+			go tracelog.Log("SIGNATURE", clientID, claims.Product, mismatch)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Signature"})
+			return false
+		}
+		return true
+	}
+
+	clientSecrets, err := secrets.GetSecrets(clientID)
+	if err != nil || len(clientSecrets) == 0 {
+		go tracelog.Log("SIGNATURE", clientID, claims.Product, fmt.Sprintf("No client secret available: %v", err))
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Client not registered or secret not found"})
+		return false
 	}
-	return buffer.String()
+
+	// Any active secret is accepted while a rotation is in progress
+	for _, secret := range clientSecrets {
+		if hmac.Equal([]byte(utils.SignHMAC(secret, stringToSign)), []byte(clientSignatureB64)) {
+			return true
+		}
+	}
+
+	go tracelog.Log("SIGNATURE", clientID, claims.Product, mismatch)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Signature"})
+	return false
 }
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"api-gateway/model"
+	"api-gateway/repository"
+	"api-gateway/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type nopTracelog struct{}
+
+func (nopTracelog) Log(proses, ca, product, message string) {}
+
+type staticSecrets []string
+
+func (s staticSecrets) GetSecrets(clientID string) ([]string, error) { return s, nil }
+
+func TestSecureProxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const secret = "shared-secret"
+	timestamp := "2025-01-01T00:00:00+07:00"
+	stringToSign := "POST:/secure/pay:token:" + utils.BodyDigest(nil) + ":" + timestamp
+
+	tests := []struct {
+		name   string
+		client model.ClientConfig
+		want   int
+	}{
+		{"hmac client with valid secret", model.ClientConfig{}, http.StatusOK},
+		{"asymmetric client with unloadable key", model.ClientConfig{SignatureMode: "asymmetric", PublicKeyPath: "testdata/missing.pem"}, http.StatusUnauthorized},
+		{"asymmetric client without key", model.ClientConfig{SignatureMode: "asymmetric"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients := func() map[string]model.ClientConfig { return map[string]model.ClientConfig{"C1": tt.client} }
+			keys := utils.NewKeyRegistry(clients, 0)
+			keys.Refresh()
+
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set(utils.ClaimsKey, &utils.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "C1"}})
+			})
+			router.POST("/secure/pay", SecureProxy(nopTracelog{}, staticSecrets{secret}, keys, clients, repository.NewMemoryReplayStore(0, time.Hour)), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			// Signed with the HMAC secret: must not be accepted for asymmetric clients
+			req := httptest.NewRequest(http.MethodPost, "/secure/pay", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			req.Header.Set("X-TIMESTAMP", timestamp)
+			req.Header.Set("X-SIGNATURE", utils.SignHMAC(secret, stringToSign))
+			req.Header.Set("X-EXTERNAL-ID", "1")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSecureProxyReservesExternalIDAfterSignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const secret = "shared-secret"
+	timestamp := "2025-01-01T00:00:00+07:00"
+	stringToSign := "POST:/secure/pay:token:" + utils.BodyDigest(nil) + ":" + timestamp
+
+	clients := func() map[string]model.ClientConfig { return map[string]model.ClientConfig{"C1": {}} }
+	keys := utils.NewKeyRegistry(clients, 0)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(utils.ClaimsKey, &utils.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "C1"}})
+	})
+	router.POST("/secure/pay", SecureProxy(nopTracelog{}, staticSecrets{secret}, keys, clients, repository.NewMemoryReplayStore(0, time.Hour)), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(signature string) int {
+		req := httptest.NewRequest(http.MethodPost, "/secure/pay", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("X-TIMESTAMP", timestamp)
+		req.Header.Set("X-SIGNATURE", signature)
+		req.Header.Set("X-EXTERNAL-ID", "42")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	steps := []struct {
+		name      string
+		signature string
+		want      int
+	}{
+		{"bad signature is rejected", "forged", http.StatusUnauthorized},
+		{"rejected request left the external ID unused", utils.SignHMAC(secret, stringToSign), http.StatusOK},
+		{"replayed external ID is rejected", utils.SignHMAC(secret, stringToSign), http.StatusConflict},
+	}
+	for _, step := range steps {
+		if got := send(step.signature); got != step.want {
+			t.Fatalf("%s: status = %d, want %d", step.name, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+-- Product entitlements, enforced since clients are entitled to nothing unless
+-- granted. Before that every client could use every product, so the clients
+-- already live are granted all current products to keep them working; trim
+-- the grants afterwards with DELETE /admin/clients/:clientId/products/:product.
+--
+-- SQL cannot read config.json: the seed names its clients, C00005 and C00006,
+-- and takes the registered ones from clients, so run clients.sql first. Add
+-- any other client of your config.json to the list before running this.
+CREATE TABLE IF NOT EXISTS client_product (
+    client_id    VARCHAR(20) NOT NULL,
+    product_name VARCHAR(50) NOT NULL,
+    PRIMARY KEY (client_id, product_name)
+);
+
+INSERT IGNORE INTO client_product (client_id, product_name)
+SELECT c.client_id, p.productName
+FROM (SELECT 'C00005' AS client_id UNION SELECT 'C00006' UNION SELECT client_id FROM clients) c
+CROSS JOIN master_product p;
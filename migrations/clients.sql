@@ -0,0 +1,30 @@
+-- Clients registered through the admin API, merged over the clients of
+-- config.json by ClientService, and the HMAC secrets of clients that sign
+-- /secure requests with signature_mode "hmac". Every column ClientRepository
+-- scans into a plain Go value is NOT NULL.
+CREATE TABLE IF NOT EXISTS clients (
+    client_id           VARCHAR(20)   NOT NULL,
+    status              VARCHAR(10)   NOT NULL DEFAULT 'active',
+    public_key          TEXT          NOT NULL,
+    signature_mode      VARCHAR(10)   NOT NULL DEFAULT '',
+    signature_algorithm VARCHAR(10)   NOT NULL DEFAULT '',
+    signature_hash      VARCHAR(10)   NOT NULL DEFAULT '',
+    allowed_ips         VARCHAR(1024) NOT NULL DEFAULT '',
+    rate_per_second     DOUBLE        NOT NULL DEFAULT 0,
+    burst               INT           NOT NULL DEFAULT 0,
+    daily_quota         INT           NOT NULL DEFAULT 0,
+    monthly_quota       INT           NOT NULL DEFAULT 0,
+    created_at          DATETIME      NOT NULL,
+    updated_at          DATETIME      NOT NULL,
+    PRIMARY KEY (client_id)
+);
+
+CREATE TABLE IF NOT EXISTS client_secret (
+    id         INT          NOT NULL AUTO_INCREMENT,
+    client_id  VARCHAR(20)  NOT NULL,
+    secret     VARCHAR(255) NOT NULL,
+    status     VARCHAR(10)  NOT NULL DEFAULT 'active',
+    expired_at DATETIME     NULL,
+    PRIMARY KEY (id),
+    INDEX (client_id)
+);
@@ -0,0 +1,11 @@
+-- Product lifecycle states (active, maintenance, suspended, retired) and
+-- scheduled maintenance windows, read by ProductRepository.GetProduct.
+--
+-- Every new column is NULL by default, so existing products keep their current
+-- state: a NULL status falls back to the legacy recid flag, under which a
+-- product is active unless recid is set. New products need no status either.
+ALTER TABLE master_product
+    ADD COLUMN status            VARCHAR(12)  NULL DEFAULT NULL,
+    ADD COLUMN maintenance_start DATETIME     NULL DEFAULT NULL,
+    ADD COLUMN maintenance_end   DATETIME     NULL DEFAULT NULL,
+    ADD COLUMN status_message    VARCHAR(255) NULL DEFAULT NULL;
@@ -0,0 +1,16 @@
+-- Rate limits shared by every replica: the token buckets of RateLimitService
+-- and its request counts for each daily or monthly quota period.
+CREATE TABLE IF NOT EXISTS rate_buckets (
+    bucket_key VARCHAR(128) NOT NULL,
+    tokens     DOUBLE       NOT NULL,
+    updated_at DATETIME(6)  NOT NULL,
+    granted    BOOLEAN      NOT NULL,
+    PRIMARY KEY (bucket_key)
+);
+
+CREATE TABLE IF NOT EXISTS rate_quotas (
+    quota_key  VARCHAR(128) NOT NULL,
+    period_end DATETIME     NOT NULL,
+    used       INT          NOT NULL,
+    PRIMARY KEY (quota_key, period_end)
+);
@@ -0,0 +1,17 @@
+-- Refresh token rotation. Every issued refresh token is recorded so it can be
+-- used once; presenting a used one revokes its family, the tokens rotated from
+-- the same login, until the last of them would have expired.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    jti        VARCHAR(64) NOT NULL,
+    family     VARCHAR(64) NOT NULL,
+    expires_at DATETIME    NOT NULL,
+    used       BOOLEAN     NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (jti),
+    INDEX (family)
+);
+
+CREATE TABLE IF NOT EXISTS refresh_families (
+    family        VARCHAR(64) NOT NULL,
+    revoked_until DATETIME    NOT NULL,
+    PRIMARY KEY (family)
+);
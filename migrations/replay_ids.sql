@@ -0,0 +1,8 @@
+-- X-EXTERNAL-ID values seen per client, shared by every replica so a request
+-- cannot be replayed against another one. Rows expire at the end of the day.
+CREATE TABLE IF NOT EXISTS replay_ids (
+    client_id   VARCHAR(20) NOT NULL,
+    external_id VARCHAR(64) NOT NULL,
+    expires_at  DATETIME    NOT NULL,
+    PRIMARY KEY (client_id, external_id)
+);
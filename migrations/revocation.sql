@@ -0,0 +1,16 @@
+-- Access token revocation: single tokens by jti until they expire, and every
+-- token of a client issued before revoked_before. Token iat claims are whole
+-- seconds, so revoked_before is too: the second after the revocation.
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti        VARCHAR(64) NOT NULL,
+    client_id  VARCHAR(20) NOT NULL,
+    expires_at DATETIME    NOT NULL,
+    revoked_at DATETIME    NOT NULL,
+    PRIMARY KEY (jti)
+);
+
+CREATE TABLE IF NOT EXISTS revoked_clients (
+    client_id      VARCHAR(20) NOT NULL,
+    revoked_before DATETIME    NOT NULL,
+    PRIMARY KEY (client_id)
+);
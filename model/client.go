@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// Client is a partner registered in the clients table.
+type Client struct {
+	ClientID           string
+	Status             string
+	PublicKey          string // PEM public key or certificate
+	SignatureMode      string
+	SignatureAlgorithm string
+	SignatureHash      string
+	Products           []string
+	AllowedIPs         []string
+	Limits             ClientLimits
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+// Apply overlays the registered settings on conf, which holds whatever
+// config.json says about the same client. Settings left empty in the table
+// keep the config.json ones. Products are not copied: the client_product rows
+// of a client are checked on their own next to the products of config.json,
+// so revoking a row never drops a product config.json lists.
+func (c Client) Apply(conf ClientConfig) ClientConfig {
+	conf.Status = c.Status
+	conf.PublicKeyPEM = c.PublicKey
+	if c.SignatureMode != "" {
+		conf.SignatureMode = c.SignatureMode
+	}
+	if c.SignatureAlgorithm != "" {
+		conf.SignatureAlgorithm = c.SignatureAlgorithm
+	}
+	if c.SignatureHash != "" {
+		conf.SignatureHash = c.SignatureHash
+	}
+	if len(c.AllowedIPs) > 0 {
+		conf.AllowedIPs = c.AllowedIPs
+	}
+	if c.Limits != (ClientLimits{}) {
+		conf.Limits = c.Limits
+	}
+	return conf
+}
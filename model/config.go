@@ -3,20 +3,189 @@ package model
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/netip"
 	"os"
+	"time"
+)
+
+const (
+	defaultAccessTokenTTL  = 900              // 15 minutes
+	defaultRefreshTokenTTL = 7 * 24 * 60 * 60 // 7 days
 )
 
 type ClientConfig struct {
+	PrivateKeyPath     string       `json:"private_key_path"`
+	PublicKeyPath      string       `json:"public_key_path"`
+	CertificatePath    string       `json:"certificate_path"` // X.509 certificate, used instead of PublicKeyPath
+	CABundlePath       string       `json:"ca_bundle_path"`   // CAs the certificate must chain to; pinned when empty
+	Scopes             []string     `json:"scopes"`
+	Secrets            []string     `json:"secrets"`             // HMAC secrets for transaction signatures
+	SignatureMode      string       `json:"signature_mode"`      // "hmac" (default) or "asymmetric" using PublicKeyPath
+	SignatureAlgorithm string       `json:"signature_algorithm"` // RSA keys: "PKCS1v15" (default) or "PSS"
+	SignatureHash      string       `json:"signature_hash"`      // "SHA-256" (default), "SHA-384" or "SHA-512"
+	ResponseSignature  string       `json:"response_signature"`  // "", "hmac" or "gateway": how proxied responses are signed
+	AccessTTL          int          `json:"access_token_ttl"`    // Seconds, 0 uses the jwt default
+	RefreshTTL         int          `json:"refresh_token_ttl"`   // Seconds, 0 uses the jwt default
+	TLSSubject         string       `json:"tls_subject"`         // Client certificate subject DN identifying the partner
+	TLSFingerprint     string       `json:"tls_fingerprint"`     // Hex SHA-256 of the client certificate's SPKI
+	RequireMTLS        bool         `json:"require_mtls"`        // Reject requests without a matching client certificate
+	Status             string       `json:"status"`              // "active" (default) or "suspended"
+	PublicKeyPEM       string       `json:"public_key_pem"`      // PEM public key or certificate, takes precedence over the paths
+	Products           []string     `json:"products"`            // Products the client is entitled to besides its client_product rows
+	AllowedIPs         []string     `json:"allowed_ips"`         // IPs or CIDRs the client may log in from, any when empty
+	Limits             ClientLimits `json:"limits"`
+}
+
+// ClientLimits caps a client's traffic. Zero values mean unlimited.
+type ClientLimits struct {
+	RatePerSecond float64 `json:"rate_per_second"`
+	Burst         int     `json:"burst"`
+	DailyQuota    int     `json:"daily_quota"`
+	MonthlyQuota  int     `json:"monthly_quota"`
+}
+
+// AllowsIP reports whether ip matches one of the client's allowed IPs or CIDRs.
+func (c ClientConfig) AllowsIP(ip string) bool {
+	if len(c.AllowedIPs) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range c.AllowedIPs {
+		if prefix, err := netip.ParsePrefix(allowed); err == nil {
+			if prefix.Contains(addr) {
+				return true
+			}
+		} else if a, err := netip.ParseAddr(allowed); err == nil && a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// JWTConfig describes the tokens issued by the gateway.
+type JWTConfig struct {
+	Issuer     string         `json:"issuer"`
+	Audience   []string       `json:"audience"`
+	Secret     string         `json:"secret"` // HS256 secret, only used when Keys is empty
+	Keys       []JWTKeyConfig `json:"keys"`
+	AccessTTL  int            `json:"access_token_ttl"`  // Seconds, defaults to 900
+	RefreshTTL int            `json:"refresh_token_ttl"` // Seconds, defaults to 7 days
+}
+
+// JWTKeyConfig is one gateway signing key. Exactly one key is Active and signs
+// new tokens; retired keys stay listed until the tokens they signed expire.
+type JWTKeyConfig struct {
+	KID            string `json:"kid"`
+	Algorithm      string `json:"algorithm"` // RS256, PS256, ES256, ES384, EdDSA, ...
 	PrivateKeyPath string `json:"private_key_path"`
 	PublicKeyPath  string `json:"public_key_path"`
+	Active         bool   `json:"active"`
+}
+
+// StoreConfig selects where shared gateway state lives: "mysql" (default) or "memory".
+type StoreConfig struct {
+	Driver           string `json:"driver"`
+	ReplayMaxEntries int    `json:"replay_max_entries"` // Memory driver only, defaults to 100000
+}
+
+// RateLimitConfig is a token bucket refilled with RatePerSecond tokens up to
+// Burst. A zero rate disables it.
+type RateLimitConfig struct {
+	RatePerSecond float64 `json:"rate_per_second"`
+	Burst         int     `json:"burst"`
+}
+
+// BurstSize defaults the burst to one second worth of requests.
+func (c RateLimitConfig) BurstSize() int {
+	if c.Burst > 0 {
+		return c.Burst
+	}
+	return max(int(math.Ceil(c.RatePerSecond)), 1)
+}
+
+// RateLimitingConfig holds the gateway wide limits. Client limits, quotas and
+// route limits live with the client and route.
+type RateLimitingConfig struct {
+	Login  RateLimitConfig `json:"login"`  // Per source IP on /auth/login
+	Client RateLimitConfig `json:"client"` // Per client on /secure unless the client sets its own
+}
+
+// ProductCacheConfig tunes the product lookup cache, in seconds unless noted.
+type ProductCacheConfig struct {
+	TTL           int `json:"ttl"`             // Defaults to 60
+	NegativeTTL   int `json:"negative_ttl"`    // Unknown products, defaults to 10
+	MaxStale      int `json:"max_stale"`       // Serve expired entries this long when the database fails or is slow, defaults to 3600
+	RefreshWaitMs int `json:"refresh_wait_ms"` // Wait this long for the database before serving an expired entry, defaults to 200
+}
+
+func (c ProductCacheConfig) TTLDuration() time.Duration {
+	return ttlSeconds(c.TTL, 60)
+}
+
+func (c ProductCacheConfig) NegativeTTLDuration() time.Duration {
+	return ttlSeconds(c.NegativeTTL, 10)
+}
+
+func (c ProductCacheConfig) StaleDuration() time.Duration {
+	return ttlSeconds(c.MaxStale, 3600)
+}
+
+func (c ProductCacheConfig) RefreshWaitDuration() time.Duration {
+	if c.RefreshWaitMs > 0 {
+		return time.Duration(c.RefreshWaitMs) * time.Millisecond
+	}
+	return 200 * time.Millisecond
+}
+
+// AdminConfig holds the keys accepted in the X-ADMIN-KEY header of /admin routes.
+type AdminConfig struct {
+	APIKeys []string `json:"api_keys"`
+}
+
+// IntrospectionConfig lists the upstream services allowed to call
+// /auth/introspect, as HTTP Basic username -> password.
+type IntrospectionConfig struct {
+	Clients map[string]string `json:"clients"`
+}
+
+// ResponseSigningConfig holds the gateway key used for response_signature "gateway".
+type ResponseSigningConfig struct {
+	PrivateKeyPath string `json:"private_key_path"`
+	MaxBodyBytes   int64  `json:"max_body_bytes"` // Largest response buffered for signing, defaults to 10 MiB
+}
+
+// TLSConfig enables TLS termination on the listener. ClientAuth is "none"
+// (default), "optional" or "require"; the latter two verify client
+// certificates against ClientCAPath.
+type TLSConfig struct {
+	Enabled      bool   `json:"enabled"`
+	CertPath     string `json:"cert_path"`
+	KeyPath      string `json:"key_path"`
+	ClientAuth   string `json:"client_auth"`
+	ClientCAPath string `json:"client_ca_path"`
 }
 
 // Config defines the overall structure of the config.json file.
 type Config struct {
-	Server   map[string]interface{}  `json:"server"`
-	Database map[string]interface{}  `json:"database"`
-	Clients  map[string]ClientConfig `json:"clients"`
-	Helper   map[string]interface{}  `json:"helper"`
+	Server                map[string]interface{}  `json:"server"`
+	Database              map[string]interface{}  `json:"database"`
+	Clients               map[string]ClientConfig `json:"clients"`
+	Helper                map[string]interface{}  `json:"helper"`
+	Routes                []RouteConfig           `json:"routes"`
+	JWT                   JWTConfig               `json:"jwt"`
+	Store                 StoreConfig             `json:"store"`
+	Admin                 AdminConfig             `json:"admin"`
+	Introspection         IntrospectionConfig     `json:"introspection"`
+	ResponseSigning       ResponseSigningConfig   `json:"response_signing"`
+	ProductCache          ProductCacheConfig      `json:"product_cache"`
+	RateLimit             RateLimitingConfig      `json:"rate_limit"`
+	TrustedProxies        []string                `json:"trusted_proxies"` // IPs/CIDRs whose X-Forwarded-For is believed; none when empty
+	TLS                   TLSConfig               `json:"tls"`
+	CertExpiryWarningDays int                     `json:"cert_expiry_warning_days"` // Defaults to 30
 }
 
 func LoadConfig() (*Config, error) {
@@ -30,3 +199,22 @@ func LoadConfig() (*Config, error) {
 	}
 	return &config, nil
 }
+
+// AccessTokenTTL returns the access token lifetime for a client.
+func (c *Config) AccessTokenTTL(client ClientConfig) time.Duration {
+	return ttlSeconds(client.AccessTTL, c.JWT.AccessTTL, defaultAccessTokenTTL)
+}
+
+// RefreshTokenTTL returns the refresh token lifetime for a client.
+func (c *Config) RefreshTokenTTL(client ClientConfig) time.Duration {
+	return ttlSeconds(client.RefreshTTL, c.JWT.RefreshTTL, defaultRefreshTokenTTL)
+}
+
+func ttlSeconds(values ...int) time.Duration {
+	for _, v := range values {
+		if v > 0 {
+			return time.Duration(v) * time.Second
+		}
+	}
+	return 0
+}
@@ -1,10 +1,49 @@
 package model
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
+
+// Product states stored in master_product.status.
+const (
+	ProductActive      = "active"
+	ProductMaintenance = "maintenance"
+	ProductSuspended   = "suspended"
+	ProductRetired     = "retired"
+)
 
 type Product struct {
-	ProductId   uint
-	ProductName string
-	Recid       sql.NullString
-	Path        string
+	ProductId        uint
+	ProductName      string
+	Recid            sql.NullString
+	Path             string
+	Status           sql.NullString
+	MaintenanceStart sql.NullTime
+	MaintenanceEnd   sql.NullTime
+	StatusMessage    sql.NullString
+}
+
+// StateAt returns the product's state at now and, during maintenance with a
+// known end, how long until it is over. An active product inside its scheduled
+// maintenance window is in maintenance. Rows without a status fall back to the
+// legacy recid flag, where a non-empty recid means suspended.
+func (p *Product) StateAt(now time.Time) (string, time.Duration) {
+	state := p.Status.String
+	if state == "" {
+		state = ProductActive
+		if p.Recid.Valid && p.Recid.String != "" {
+			state = ProductSuspended
+		}
+	}
+
+	inWindow := p.MaintenanceStart.Valid && !now.Before(p.MaintenanceStart.Time) &&
+		(!p.MaintenanceEnd.Valid || now.Before(p.MaintenanceEnd.Time))
+	if state == ProductActive && inWindow {
+		state = ProductMaintenance
+	}
+	if state == ProductMaintenance && p.MaintenanceEnd.Valid && now.Before(p.MaintenanceEnd.Time) {
+		return state, p.MaintenanceEnd.Time.Sub(now)
+	}
+	return state, 0
 }
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestProductStateAt(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	status := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	at := func(d time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(d), Valid: true} }
+
+	tests := []struct {
+		name       string
+		product    Product
+		want       string
+		retryAfter time.Duration
+	}{
+		{"no status and no recid", Product{}, ProductActive, 0},
+		{"legacy recid", Product{Recid: status("X1")}, ProductSuspended, 0},
+		{"empty legacy recid", Product{Recid: status("")}, ProductActive, 0},
+		{"status wins over recid", Product{Status: status(ProductActive), Recid: status("X1")}, ProductActive, 0},
+		{"retired", Product{Status: status(ProductRetired)}, ProductRetired, 0},
+		{"suspended during a window", Product{Status: status(ProductSuspended), MaintenanceStart: at(-time.Hour), MaintenanceEnd: at(time.Hour)}, ProductSuspended, 0},
+		{"active inside the window", Product{Status: status(ProductActive), MaintenanceStart: at(-time.Hour), MaintenanceEnd: at(30 * time.Minute)}, ProductMaintenance, 30 * time.Minute},
+		{"active at the window start", Product{MaintenanceStart: at(0), MaintenanceEnd: at(time.Hour)}, ProductMaintenance, time.Hour},
+		{"active at the window end", Product{MaintenanceStart: at(-time.Hour), MaintenanceEnd: at(0)}, ProductActive, 0},
+		{"active before the window", Product{MaintenanceStart: at(time.Hour), MaintenanceEnd: at(2 * time.Hour)}, ProductActive, 0},
+		{"open ended window", Product{MaintenanceStart: at(-time.Hour)}, ProductMaintenance, 0},
+		{"maintenance status without window", Product{Status: status(ProductMaintenance)}, ProductMaintenance, 0},
+		{"maintenance status with a known end", Product{Status: status(ProductMaintenance), MaintenanceEnd: at(10 * time.Minute)}, ProductMaintenance, 10 * time.Minute},
+		{"maintenance status past its end", Product{Status: status(ProductMaintenance), MaintenanceEnd: at(-time.Minute)}, ProductMaintenance, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, retryAfter := tt.product.StateAt(now)
+			if state != tt.want || retryAfter != tt.retryAfter {
+				t.Fatalf("StateAt() = %q, %v, want %q, %v", state, retryAfter, tt.want, tt.retryAfter)
+			}
+		})
+	}
+}
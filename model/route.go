@@ -0,0 +1,60 @@
+package model
+
+// RouteConfig maps a path prefix under /secure to a registered upstream.
+// PathPrefix is matched against the part of the URL after /secure.
+type RouteConfig struct {
+	Name          string             `json:"name"`
+	PathPrefix    string             `json:"path_prefix"`
+	Methods       []string           `json:"methods"`        // Empty means every method
+	Upstream      string             `json:"upstream"`       // Base URL, e.g. "http://10.0.0.5:8080/api"
+	FromProduct   bool               `json:"from_product"`   // Use master_product.path of the token's product as Upstream
+	StripPrefix   bool               `json:"strip_prefix"`   // Drop PathPrefix before forwarding
+	RewritePrefix string             `json:"rewrite_prefix"` // Replaces PathPrefix (implies strip)
+	AllowTarget   bool               `json:"allow_target"`   // Honor the legacy ?target= parameter
+	TargetHosts   []string           `json:"target_hosts"`   // Hosts ?target= may point to, empty means any
+	Scopes        []string           `json:"scopes"`         // Scopes the access token must carry
+	SkipSignature bool               `json:"skip_signature"` // Do not require an X-SIGNATURE transaction signature
+	UpstreamAuth  UpstreamAuthConfig `json:"upstream_auth"`
+	RateLimit     RateLimitConfig    `json:"rate_limit"` // Per client on this route, on top of the client's own limit
+	Timeout       int                `json:"timeout"`    // Seconds per upstream request, defaults to 30
+	Concurrency   ConcurrencyConfig  `json:"concurrency"`
+}
+
+// ConcurrencyConfig caps the requests in flight to each upstream of a route.
+// Requests over MaxInFlight wait in a queue of MaxQueue for up to
+// QueueTimeoutMs, after which they are shed with 503. With TargetLatencyMs the
+// limit adapts between MinInFlight and MaxInFlight to the upstream's latency,
+// counting 5xx answers and transport errors as failures.
+//
+// Every route has its own budget per upstream host: two routes sending to the
+// same host are limited separately, so their MaxInFlight add up.
+type ConcurrencyConfig struct {
+	MaxInFlight     int `json:"max_in_flight"` // 0 disables the limit
+	MinInFlight     int `json:"min_in_flight"` // Adaptive floor, defaults to 1
+	MaxQueue        int `json:"max_queue"`
+	QueueTimeoutMs  int `json:"queue_timeout_ms"`  // Defaults to 100
+	TargetLatencyMs int `json:"target_latency_ms"` // 0 keeps the limit fixed
+}
+
+// UpstreamAuthConfig is how the gateway authenticates itself to a route's upstream.
+// Mode is one of:
+//
+//	"passthrough" (default) add no gateway credentials
+//	"jwt"   send a short lived gateway token, verifiable via the JWKS
+//	"hmac"  send X-TIMESTAMP and an HMAC-SHA512 X-SIGNATURE using Secret
+//	"mtls"  rely on the client certificate alone, which ClientCertPath must set
+//
+// The partner's own credential headers are always removed, except in
+// passthrough mode with ForwardPartnerCredentials, for upstreams that still
+// check the partner's token or signature themselves.
+// ClientCertPath/ClientKeyPath/CAPath apply to every mode when set.
+type UpstreamAuthConfig struct {
+	Mode           string `json:"mode"`
+	Audience       string `json:"audience"` // jwt: token audience, defaults to the route name
+	Secret         string `json:"secret"`
+	ClientCertPath string `json:"client_cert_path"`
+	ClientKeyPath  string `json:"client_key_path"`
+	CAPath         string `json:"ca_path"`
+
+	ForwardPartnerCredentials bool `json:"forward_partner_credentials"`
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"api-gateway/model"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	ErrClientNotFound = errors.New("client not found")
+	ErrClientExists   = errors.New("client already exists")
+)
+
+// mysqlDuplicateEntry is the MySQL error number for a duplicate key.
+const mysqlDuplicateEntry = 1062
+
+// ClientRepository stores the partners onboarded through the admin API.
+//
+// The MySQL implementation expects, see migrations/clients.sql:
+//
+//	clients (client_id VARCHAR(20) PRIMARY KEY, status VARCHAR(10), public_key TEXT,
+//	         signature_mode VARCHAR(10), signature_algorithm VARCHAR(10), signature_hash VARCHAR(10),
+//	         allowed_ips VARCHAR(1024), rate_per_second DOUBLE, burst INT, daily_quota INT,
+//	         monthly_quota INT, created_at DATETIME, updated_at DATETIME)
+//
+// and reads the products of each client from client_product, see ProductRepository.
+type ClientRepository interface {
+	GetAll() ([]model.Client, error)
+	Create(client model.Client) error
+	UpdateStatus(clientID, status string) error
+	UpdatePublicKey(clientID, publicKey string) error
+}
+
+type clientRepository struct {
+	db *sql.DB
+}
+
+func NewClientRepository(db *sql.DB) ClientRepository {
+	return &clientRepository{db: db}
+}
+
+func (r *clientRepository) GetAll() ([]model.Client, error) {
+	rows, err := r.db.Query(`
+		SELECT client_id, status, public_key, signature_mode, signature_algorithm, signature_hash,
+			allowed_ips, rate_per_second, burst, daily_quota, monthly_quota, created_at, updated_at
+		FROM clients ORDER BY client_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []model.Client
+	index := map[string]int{}
+	for rows.Next() {
+		var client model.Client
+		var allowedIPs string
+		err := rows.Scan(&client.ClientID, &client.Status, &client.PublicKey, &client.SignatureMode,
+			&client.SignatureAlgorithm, &client.SignatureHash, &allowedIPs, &client.Limits.RatePerSecond,
+			&client.Limits.Burst, &client.Limits.DailyQuota, &client.Limits.MonthlyQuota, &client.CreatedAt, &client.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if allowedIPs != "" {
+			client.AllowedIPs = strings.Split(allowedIPs, ",")
+		}
+		index[client.ClientID] = len(clients)
+		clients = append(clients, client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	products, err := r.db.Query(`SELECT client_id, product_name FROM client_product ORDER BY client_id, product_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer products.Close()
+	for products.Next() {
+		var clientID, product string
+		if err := products.Scan(&clientID, &product); err != nil {
+			return nil, err
+		}
+		if i, ok := index[clientID]; ok {
+			clients[i].Products = append(clients[i].Products, product)
+		}
+	}
+	return clients, products.Err()
+}
+
+func (r *clientRepository) Create(client model.Client) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO clients (client_id, status, public_key, signature_mode, signature_algorithm, signature_hash,
+			allowed_ips, rate_per_second, burst, daily_quota, monthly_quota, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())
+	`, client.ClientID, client.Status, client.PublicKey, client.SignatureMode, client.SignatureAlgorithm,
+		client.SignatureHash, strings.Join(client.AllowedIPs, ","), client.Limits.RatePerSecond,
+		client.Limits.Burst, client.Limits.DailyQuota, client.Limits.MonthlyQuota)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return ErrClientExists
+	}
+	if err != nil {
+		return err
+	}
+	for _, product := range client.Products {
+		if _, err := tx.Exec(`INSERT INTO client_product (client_id, product_name) VALUES (?, ?)`, client.ClientID, product); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *clientRepository) UpdateStatus(clientID, status string) error {
+	return r.update(`UPDATE clients SET status = ?, updated_at = NOW() WHERE client_id = ?`, status, clientID)
+}
+
+func (r *clientRepository) UpdatePublicKey(clientID, publicKey string) error {
+	return r.update(`UPDATE clients SET public_key = ?, updated_at = NOW() WHERE client_id = ?`, publicKey, clientID)
+}
+
+func (r *clientRepository) update(query string, args ...any) error {
+	stmt, err := r.db.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"database/sql"
+)
+
+// ClientSecretRepository loads the HMAC secrets of a client. Several secrets
+// may be active at once so a partner can rotate without downtime.
+//
+// The MySQL implementation expects, see migrations/clients.sql:
+//
+//	client_secret (id INT AUTO_INCREMENT PRIMARY KEY, client_id VARCHAR(20), secret VARCHAR(255),
+//	               status VARCHAR(10), expired_at DATETIME NULL, INDEX (client_id))
+type ClientSecretRepository interface {
+	// GetActiveSecrets returns the usable secrets, newest first.
+	GetActiveSecrets(clientID string) ([]string, error)
+}
+
+type clientSecretRepository struct {
+	db *sql.DB
+}
+
+func NewClientSecretRepository(db *sql.DB) ClientSecretRepository {
+	return &clientSecretRepository{db: db}
+}
+
+func (r *clientSecretRepository) GetActiveSecrets(clientID string) ([]string, error) {
+	stmt, err := r.db.Prepare(`
+		SELECT secret FROM client_secret
+		WHERE client_id = ? AND status = 'active' AND (expired_at IS NULL OR expired_at > NOW())
+		ORDER BY id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(clientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var secrets []string
+	for rows.Next() {
+		var secret string
+		if err := rows.Scan(&secret); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, rows.Err()
+}
@@ -5,8 +5,19 @@ import (
 	"database/sql"
 )
 
+// ProductRepository reads master_product and the client_product entitlements,
+// see migrations/master_product_status.sql and migrations/client_product.sql.
+// A NULL status falls back to the legacy recid flag, see model.Product.StateAt:
+//
+//	master_product (..., productName VARCHAR(50), recid VARCHAR(20) NULL, path VARCHAR(255),
+//	                status VARCHAR(12) NULL, maintenance_start DATETIME NULL,
+//	                maintenance_end DATETIME NULL, status_message VARCHAR(255) NULL)
+//	client_product (client_id VARCHAR(20), product_name VARCHAR(50), PRIMARY KEY (client_id, product_name))
 type ProductRepository interface {
 	GetProduct(product string) (*model.Product, error)
+	IsEntitled(product, clientID string) (bool, error)
+	Grant(product, clientID string) error
+	Revoke(product, clientID string) error
 }
 
 type productRepository struct {
@@ -19,7 +30,8 @@ func NewProductRepository(d *sql.DB) ProductRepository {
 
 func (r *productRepository) GetProduct(p string) (*model.Product, error) {
 	stmt, err := r.db.Prepare(`
-		SELECT productName, recid, path FROM master_product WHERE productName = ?
+		SELECT productName, recid, COALESCE(path, ''), status, maintenance_start, maintenance_end, status_message
+		FROM master_product WHERE productName = ?
 	`)
 	if err != nil {
 		return nil, err
@@ -28,9 +40,49 @@ func (r *productRepository) GetProduct(p string) (*model.Product, error) {
 
 	product := &model.Product{}
 
-	err = stmt.QueryRow(p).Scan(&product.ProductName, &product.Recid, &product.Path)
+	err = stmt.QueryRow(p).Scan(&product.ProductName, &product.Recid, &product.Path, &product.Status,
+		&product.MaintenanceStart, &product.MaintenanceEnd, &product.StatusMessage)
 	if err != nil {
 		return nil, err
 	}
 	return product, nil
 }
+
+func (r *productRepository) IsEntitled(p, clientID string) (bool, error) {
+	stmt, err := r.db.Prepare(`
+		SELECT EXISTS (SELECT 1 FROM client_product WHERE client_id = ? AND product_name = ?)
+	`)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	var entitled bool
+	err = stmt.QueryRow(clientID, p).Scan(&entitled)
+	if err != nil {
+		return false, err
+	}
+	return entitled, nil
+}
+
+func (r *productRepository) Grant(p, clientID string) error {
+	stmt, err := r.db.Prepare(`INSERT IGNORE INTO client_product (client_id, product_name) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(clientID, p)
+	return err
+}
+
+func (r *productRepository) Revoke(p, clientID string) error {
+	stmt, err := r.db.Prepare(`DELETE FROM client_product WHERE client_id = ? AND product_name = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(clientID, p)
+	return err
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitStore keeps the token buckets and quota counters of the rate limiter.
+//
+// The MySQL implementation expects, see migrations/rate_limit.sql:
+//
+//	rate_buckets (bucket_key VARCHAR(128) PRIMARY KEY, tokens DOUBLE, updated_at DATETIME(6), granted BOOLEAN)
+//	rate_quotas  (quota_key VARCHAR(128), period_end DATETIME, used INT, PRIMARY KEY (quota_key, period_end))
+type RateLimitStore interface {
+	// TakeToken removes one token from the bucket key, which refills at rate
+	// tokens per second up to burst. It returns the tokens left and whether
+	// one was available.
+	TakeToken(key string, rate float64, burst int, now time.Time) (float64, bool, error)
+	// ReturnToken puts back a token taken for a request another limit denied.
+	ReturnToken(key string, burst int) error
+	// ConsumeQuota counts one request against key for the period ending at
+	// periodEnd unless limit is reached. It returns the requests counted so far
+	// and whether this one was.
+	ConsumeQuota(key string, limit int, periodEnd time.Time) (int, bool, error)
+	// ReturnQuota uncounts a request another limit denied.
+	ReturnQuota(key string, periodEnd time.Time) error
+}
+
+// refill returns the tokens of a bucket last updated at last.
+func refill(tokens float64, last, now time.Time, rate float64, burst int) float64 {
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens += elapsed * rate
+	}
+	return math.Min(tokens, float64(burst))
+}
+
+type rateLimitStore struct {
+	db *sql.DB
+}
+
+// NewRateLimitStore returns a MySQL backed store shared by every replica.
+// Idle buckets and finished quota periods are deleted hourly.
+func NewRateLimitStore(db *sql.DB) RateLimitStore {
+	s := &rateLimitStore{db: db}
+	go s.sweepEvery(time.Hour)
+	return s
+}
+
+func (s *rateLimitStore) TakeToken(key string, rate float64, burst int, now time.Time) (float64, bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	// One statement refills and takes a token, so the only lock taken is the
+	// row's exclusive one. New buckets start full minus this request. The
+	// assignments run in order: granted and tokens still see the old updated_at.
+	_, err = tx.Exec(`
+		INSERT INTO rate_buckets (bucket_key, tokens, updated_at, granted) VALUES (?, ?, ?, TRUE)
+		ON DUPLICATE KEY UPDATE
+			granted = LEAST(?, tokens + GREATEST(TIMESTAMPDIFF(MICROSECOND, updated_at, ?), 0) / 1000000 * ?) >= 1,
+			tokens = LEAST(?, tokens + GREATEST(TIMESTAMPDIFF(MICROSECOND, updated_at, ?), 0) / 1000000 * ?) - granted,
+			updated_at = GREATEST(updated_at, ?)
+	`, key, burst-1, now, burst, now, rate, burst, now, rate, now)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// The row stays locked by this transaction, so this reads our own outcome
+	var tokens float64
+	var granted bool
+	err = tx.QueryRow(`SELECT tokens, granted FROM rate_buckets WHERE bucket_key = ?`, key).Scan(&tokens, &granted)
+	if err != nil {
+		return 0, false, err
+	}
+	return tokens, granted, tx.Commit()
+}
+
+func (s *rateLimitStore) ConsumeQuota(key string, limit int, periodEnd time.Time) (int, bool, error) {
+	// A full counter is left untouched so the statement affects zero rows
+	stmt, err := s.db.Prepare(`
+		INSERT INTO rate_quotas (quota_key, period_end, used) VALUES (?, ?, 1)
+		ON DUPLICATE KEY UPDATE used = IF(used < ?, used + 1, used)
+	`)
+	if err != nil {
+		return 0, false, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(key, periodEnd, limit)
+	if err != nil {
+		return 0, false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, false, err
+	}
+
+	var used int
+	err = s.db.QueryRow(`SELECT used FROM rate_quotas WHERE quota_key = ? AND period_end = ?`, key, periodEnd).Scan(&used)
+	if err != nil {
+		return 0, false, err
+	}
+	return used, affected > 0, nil
+}
+
+func (s *rateLimitStore) ReturnToken(key string, burst int) error {
+	_, err := s.db.Exec(`UPDATE rate_buckets SET tokens = LEAST(?, tokens + 1) WHERE bucket_key = ?`, burst, key)
+	return err
+}
+
+func (s *rateLimitStore) ReturnQuota(key string, periodEnd time.Time) error {
+	_, err := s.db.Exec(`UPDATE rate_quotas SET used = GREATEST(used - 1, 0) WHERE quota_key = ? AND period_end = ?`, key, periodEnd)
+	return err
+}
+
+func (s *rateLimitStore) sweepEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := s.db.Exec(`DELETE FROM rate_quotas WHERE period_end < NOW()`); err != nil {
+			log.Printf("Failed to sweep rate_quotas: %v", err)
+		}
+		if _, err := s.db.Exec(`DELETE FROM rate_buckets WHERE updated_at < NOW() - INTERVAL 1 DAY`); err != nil {
+			log.Printf("Failed to sweep rate_buckets: %v", err)
+		}
+	}
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+type quota struct {
+	used      int
+	periodEnd time.Time
+}
+
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	quotas  map[string]*quota
+}
+
+// NewMemoryRateLimitStore keeps buckets and quotas in process memory, so every
+// replica enforces its own limits and quotas restart on deploy.
+func NewMemoryRateLimitStore(sweepInterval time.Duration) RateLimitStore {
+	s := &memoryRateLimitStore{buckets: map[string]*bucket{}, quotas: map[string]*quota{}}
+	go func() {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.sweep(time.Now())
+		}
+	}()
+	return s
+}
+
+func (s *memoryRateLimitStore) TakeToken(key string, rate float64, burst int, now time.Time) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updatedAt: now}
+		s.buckets[key] = b
+	}
+	b.tokens = refill(b.tokens, b.updatedAt, now, rate, burst)
+	b.updatedAt = now
+	if b.tokens < 1 {
+		return b.tokens, false, nil
+	}
+	b.tokens--
+	return b.tokens, true, nil
+}
+
+func (s *memoryRateLimitStore) ConsumeQuota(key string, limit int, periodEnd time.Time) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.quotas[key]
+	if !ok || !q.periodEnd.Equal(periodEnd) {
+		q = &quota{periodEnd: periodEnd}
+		s.quotas[key] = q
+	}
+	if q.used >= limit {
+		return q.used, false, nil
+	}
+	q.used++
+	return q.used, true, nil
+}
+
+func (s *memoryRateLimitStore) ReturnToken(key string, burst int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.buckets[key]; ok {
+		b.tokens = math.Min(b.tokens+1, float64(burst))
+	}
+	return nil
+}
+
+func (s *memoryRateLimitStore) ReturnQuota(key string, periodEnd time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.quotas[key]; ok && q.periodEnd.Equal(periodEnd) && q.used > 0 {
+		q.used--
+	}
+	return nil
+}
+
+// sweep drops finished quota periods and buckets idle for a day.
+func (s *memoryRateLimitStore) sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, q := range s.quotas {
+		if now.After(q.periodEnd) {
+			delete(s.quotas, key)
+		}
+	}
+	for key, b := range s.buckets {
+		if now.Sub(b.updatedAt) > 24*time.Hour {
+			delete(s.buckets, key)
+		}
+	}
+}
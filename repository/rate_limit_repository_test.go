@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefill(t *testing.T) {
+	last := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		rate    float64
+		burst   int
+		want    float64
+	}{
+		{"no time passed", 2, 0, 1, 10, 2},
+		{"partial refill", 0, 1500 * time.Millisecond, 2, 10, 3},
+		{"capped at burst", 8, 10 * time.Second, 1, 10, 10},
+		{"clock went back", 4, -time.Second, 1, 10, 4},
+		{"empty bucket fractional", 0.25, 250 * time.Millisecond, 1, 5, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refill(tt.tokens, last, last.Add(tt.elapsed), tt.rate, tt.burst); got != tt.want {
+				t.Errorf("refill() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	s := NewMemoryRateLimitStore(time.Hour)
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if _, ok, _ := s.TakeToken("k", 1, 2, now); !ok {
+			t.Fatalf("take %d denied within burst", i)
+		}
+	}
+	if _, ok, _ := s.TakeToken("k", 1, 2, now); ok {
+		t.Fatal("take allowed over burst")
+	}
+	if err := s.ReturnToken("k", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.TakeToken("k", 1, 2, now); !ok {
+		t.Fatal("returned token not available")
+	}
+
+	end := now.Add(time.Hour)
+	if used, ok, _ := s.ConsumeQuota("q", 1, end); !ok || used != 1 {
+		t.Fatalf("ConsumeQuota() = %d, %v", used, ok)
+	}
+	if _, ok, _ := s.ConsumeQuota("q", 1, end); ok {
+		t.Fatal("quota allowed over limit")
+	}
+	if err := s.ReturnQuota("q", end); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.ConsumeQuota("q", 1, end); !ok {
+		t.Fatal("returned quota not available")
+	}
+	if _, ok, _ := s.ConsumeQuota("q", 1, end.Add(time.Hour)); !ok {
+		t.Fatal("new period did not reset the quota")
+	}
+}
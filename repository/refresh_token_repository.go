@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRefreshTokenUnknown = errors.New("refresh token not recognized")
+	ErrRefreshTokenReused  = errors.New("refresh token already used")
+	ErrRefreshTokenRevoked = errors.New("refresh token family revoked")
+)
+
+// RefreshTokenStore tracks issued refresh tokens so each one can be used once.
+// Every token rotated from the same login shares a family; presenting an
+// already used token revokes that family, since it signals theft. Access
+// tokens already issued to the family are not revoked and run until expiry.
+//
+// The MySQL implementation expects, see migrations/refresh_tokens.sql:
+//
+//	refresh_tokens   (jti VARCHAR(64) PRIMARY KEY, family VARCHAR(64), expires_at DATETIME,
+//	                  used BOOLEAN NOT NULL DEFAULT FALSE, INDEX (family))
+//	refresh_families (family VARCHAR(64) PRIMARY KEY, revoked_until DATETIME)
+type RefreshTokenStore interface {
+	// Issue records a newly issued refresh token.
+	Issue(jti, family string, expiresAt time.Time) error
+	// Use marks the refresh token as consumed. It fails with one of the
+	// ErrRefreshToken errors when the token was never issued, was already
+	// used or belongs to a revoked family.
+	Use(jti string) error
+	// RevokeFamily invalidates every refresh token rotated from the same login.
+	RevokeFamily(family string) error
+}
+
+type refreshTokenStore struct {
+	db *sql.DB
+}
+
+// NewRefreshTokenStore returns a MySQL backed store shared by every replica.
+// Expired tokens and revocations are deleted hourly in the background.
+func NewRefreshTokenStore(db *sql.DB) RefreshTokenStore {
+	s := &refreshTokenStore{db: db}
+	go s.sweepEvery(time.Hour)
+	return s
+}
+
+func (s *refreshTokenStore) Issue(jti, family string, expiresAt time.Time) error {
+	stmt, err := s.db.Prepare(`INSERT INTO refresh_tokens (jti, family, expires_at) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(jti, family, expiresAt)
+	return err
+}
+
+func (s *refreshTokenStore) Use(jti string) error {
+	// Only one of several concurrent uses can flip used, the others see it set
+	result, err := s.db.Exec(`
+		UPDATE refresh_tokens SET used = TRUE
+		WHERE jti = ? AND used = FALSE AND expires_at > NOW()
+			AND family NOT IN (SELECT family FROM refresh_families)
+	`, jti)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	var family string
+	var used, live, revoked bool
+	err = s.db.QueryRow(`
+		SELECT t.family, t.used, t.expires_at > NOW(), f.family IS NOT NULL
+		FROM refresh_tokens t LEFT JOIN refresh_families f ON f.family = t.family
+		WHERE t.jti = ?
+	`, jti).Scan(&family, &used, &live, &revoked)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrRefreshTokenUnknown
+	case err != nil:
+		return err
+	case !live:
+		return ErrRefreshTokenUnknown
+	case revoked:
+		return ErrRefreshTokenRevoked
+	}
+	if err := s.RevokeFamily(family); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+func (s *refreshTokenStore) RevokeFamily(family string) error {
+	// The revocation is kept until the family's newest token expires
+	var until time.Time
+	err := s.db.QueryRow(`SELECT COALESCE(MAX(expires_at), NOW()) FROM refresh_tokens WHERE family = ?`, family).Scan(&until)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO refresh_families (family, revoked_until) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE revoked_until = GREATEST(revoked_until, VALUES(revoked_until))
+	`, family, until)
+	return err
+}
+
+func (s *refreshTokenStore) sweepEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := s.db.Exec(`DELETE FROM refresh_tokens WHERE expires_at < NOW()`); err != nil {
+			log.Printf("Failed to sweep refresh_tokens: %v", err)
+		}
+		if _, err := s.db.Exec(`DELETE FROM refresh_families WHERE revoked_until < NOW()`); err != nil {
+			log.Printf("Failed to sweep refresh_families: %v", err)
+		}
+	}
+}
+
+type refreshEntry struct {
+	family    string
+	expiresAt time.Time
+	used      bool
+}
+
+type memoryRefreshTokenStore struct {
+	mu        sync.Mutex
+	tokens    map[string]*refreshEntry
+	revoked   map[string]time.Time // family -> expiry of its newest token
+	lastSweep time.Time
+}
+
+// NewMemoryRefreshTokenStore keeps refresh tokens in process memory. They are
+// lost on restart and not shared between replicas, so a partner must refresh
+// against the replica that issued its token.
+func NewMemoryRefreshTokenStore() RefreshTokenStore {
+	return &memoryRefreshTokenStore{
+		tokens:  map[string]*refreshEntry{},
+		revoked: map[string]time.Time{},
+	}
+}
+
+func (s *memoryRefreshTokenStore) Issue(jti, family string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	s.tokens[jti] = &refreshEntry{family: family, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) Use(jti string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.tokens[jti]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return ErrRefreshTokenUnknown
+	}
+	if _, revoked := s.revoked[entry.family]; revoked {
+		return ErrRefreshTokenRevoked
+	}
+	if entry.used {
+		s.revokeFamily(entry.family)
+		return ErrRefreshTokenReused
+	}
+	entry.used = true
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) RevokeFamily(family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokeFamily(family)
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) revokeFamily(family string) {
+	var expiry time.Time
+	for _, entry := range s.tokens {
+		if entry.family == family && entry.expiresAt.After(expiry) {
+			expiry = entry.expiresAt
+		}
+	}
+	s.revoked[family] = expiry
+}
+
+// sweep drops expired entries at most once a minute. Callers hold s.mu.
+func (s *memoryRefreshTokenStore) sweep() {
+	now := time.Now()
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for jti, entry := range s.tokens {
+		if now.After(entry.expiresAt) {
+			delete(s.tokens, jti)
+		}
+	}
+	for family, expiry := range s.revoked {
+		if now.After(expiry) {
+			delete(s.revoked, family)
+		}
+	}
+}
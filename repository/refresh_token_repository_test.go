@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryRefreshTokenStore(t *testing.T) {
+	s := NewMemoryRefreshTokenStore()
+	expiresAt := time.Now().Add(time.Hour)
+	s.Issue("r1", "login", expiresAt)
+	s.Issue("r2", "login", expiresAt)
+	s.Issue("expired", "other", time.Now().Add(-time.Second))
+
+	steps := []struct {
+		name string
+		jti  string
+		want error
+	}{
+		{"first use", "r1", nil},
+		{"never issued", "missing", ErrRefreshTokenUnknown},
+		{"expired", "expired", ErrRefreshTokenUnknown},
+		{"reuse revokes the family", "r1", ErrRefreshTokenReused},
+		{"sibling of a reused token", "r2", ErrRefreshTokenRevoked},
+	}
+	for _, step := range steps {
+		if err := s.Use(step.jti); !errors.Is(err, step.want) {
+			t.Fatalf("%s: Use(%q) = %v, want %v", step.name, step.jti, err, step.want)
+		}
+	}
+}
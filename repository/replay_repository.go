@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var ErrReplayStoreFull = errors.New("replay store is full")
+
+// ReplayStore remembers which X-EXTERNAL-ID values a client has already used.
+//
+// The MySQL implementation expects, see migrations/replay_ids.sql:
+//
+//	replay_ids (client_id VARCHAR(20), external_id VARCHAR(64), expires_at DATETIME,
+//	            PRIMARY KEY (client_id, external_id))
+type ReplayStore interface {
+	// Reserve atomically records externalID for clientID until expiresAt. It
+	// returns false when the pair is already recorded and has not expired.
+	Reserve(clientID, externalID string, expiresAt time.Time) (bool, error)
+}
+
+type replayStore struct {
+	db *sql.DB
+}
+
+// NewReplayStore returns a MySQL backed store shared by every replica. Expired
+// rows are deleted hourly in the background.
+func NewReplayStore(db *sql.DB) ReplayStore {
+	s := &replayStore{db: db}
+	go s.sweepEvery(time.Hour)
+	return s
+}
+
+func (s *replayStore) Reserve(clientID, externalID string, expiresAt time.Time) (bool, error) {
+	// An expired row is taken over by the new reservation, a live one is left
+	// untouched so the statement affects zero rows.
+	stmt, err := s.db.Prepare(`
+		INSERT INTO replay_ids (client_id, external_id, expires_at) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE expires_at = IF(expires_at < NOW(), VALUES(expires_at), expires_at)
+	`)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(clientID, externalID, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *replayStore) sweepEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := s.db.Exec(`DELETE FROM replay_ids WHERE expires_at < NOW()`); err != nil {
+			log.Printf("Failed to sweep replay_ids: %v", err)
+		}
+	}
+}
+
+type memoryReplayStore struct {
+	mu         sync.Mutex
+	entries    map[string]time.Time
+	maxEntries int
+}
+
+// NewMemoryReplayStore keeps reservations in process memory, sweeping expired
+// ones every sweepInterval. Once maxEntries live reservations exist new ones
+// are refused rather than evicting entries that still protect a window.
+func NewMemoryReplayStore(maxEntries int, sweepInterval time.Duration) ReplayStore {
+	s := &memoryReplayStore{entries: map[string]time.Time{}, maxEntries: maxEntries}
+	go func() {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.mu.Lock()
+			s.sweep(time.Now())
+			s.mu.Unlock()
+		}
+	}()
+	return s
+}
+
+func (s *memoryReplayStore) Reserve(clientID, externalID string, expiresAt time.Time) (bool, error) {
+	key := clientID + "|" + externalID
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expiry, ok := s.entries[key]; ok && now.Before(expiry) {
+		return false, nil
+	}
+	if s.maxEntries > 0 && len(s.entries) >= s.maxEntries {
+		s.sweep(now)
+		if len(s.entries) >= s.maxEntries {
+			return false, ErrReplayStoreFull
+		}
+	}
+	s.entries[key] = expiresAt
+	return true, nil
+}
+
+// sweep drops expired reservations. Callers hold s.mu.
+func (s *memoryReplayStore) sweep(now time.Time) {
+	for key, expiry := range s.entries {
+		if !now.Before(expiry) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+)
+
+// RevocationRepository records tokens killed before their expiry, either one
+// token by jti or every token a client was issued before a cutoff. Revoked
+// tokens are forgotten hourly once they would have expired anyway.
+//
+// Token iat claims are whole seconds, so a client cutoff also covers the
+// tokens issued later in its second: a token from just before the cutoff
+// carries the same iat as one from just after it.
+//
+// The MySQL implementation expects, see migrations/revocation.sql:
+//
+//	revoked_tokens  (jti VARCHAR(64) PRIMARY KEY, client_id VARCHAR(20), expires_at DATETIME, revoked_at DATETIME)
+//	revoked_clients (client_id VARCHAR(20) PRIMARY KEY, revoked_before DATETIME)
+type RevocationRepository interface {
+	Revoke(jti, clientID string, expiresAt time.Time) error
+	RevokeClient(clientID string, before time.Time) error
+	IsRevoked(jti, clientID string, issuedAt time.Time) (bool, error)
+}
+
+type revocationRepository struct {
+	db *sql.DB
+}
+
+func NewRevocationRepository(db *sql.DB) RevocationRepository {
+	r := &revocationRepository{db: db}
+	go r.sweepEvery(time.Hour)
+	return r
+}
+
+func (r *revocationRepository) sweepEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := r.db.Exec(`DELETE FROM revoked_tokens WHERE expires_at < NOW()`); err != nil {
+			log.Printf("Failed to sweep revoked_tokens: %v", err)
+		}
+	}
+}
+
+func (r *revocationRepository) Revoke(jti, clientID string, expiresAt time.Time) error {
+	stmt, err := r.db.Prepare(`
+		INSERT IGNORE INTO revoked_tokens (jti, client_id, expires_at, revoked_at)
+		VALUES (?, ?, ?, NOW())
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(jti, clientID, expiresAt)
+	return err
+}
+
+func (r *revocationRepository) RevokeClient(clientID string, before time.Time) error {
+	stmt, err := r.db.Prepare(`
+		INSERT INTO revoked_clients (client_id, revoked_before) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE revoked_before = VALUES(revoked_before)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(clientID, clientCutoff(before))
+	return err
+}
+
+func (r *revocationRepository) IsRevoked(jti, clientID string, issuedAt time.Time) (bool, error) {
+	stmt, err := r.db.Prepare(`
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?)
+			OR EXISTS (SELECT 1 FROM revoked_clients WHERE client_id = ? AND revoked_before > ?)
+	`)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	var revoked bool
+	err = stmt.QueryRow(jti, clientID, issuedAt).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+type memoryRevocationRepository struct {
+	mu      sync.RWMutex
+	tokens  map[string]time.Time // jti -> token expiry
+	clients map[string]time.Time // client -> revoked before
+}
+
+// NewMemoryRevocationRepository keeps revocations in process memory. They are
+// lost on restart and not shared between replicas.
+func NewMemoryRevocationRepository() RevocationRepository {
+	r := &memoryRevocationRepository{
+		tokens:  map[string]time.Time{},
+		clients: map[string]time.Time{},
+	}
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			r.sweep(time.Now())
+		}
+	}()
+	return r
+}
+
+func (r *memoryRevocationRepository) Revoke(jti, clientID string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[jti] = expiresAt
+	return nil
+}
+
+// sweep drops revoked tokens that have expired.
+func (r *memoryRevocationRepository) sweep(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, expiry := range r.tokens {
+		if now.After(expiry) {
+			delete(r.tokens, id)
+		}
+	}
+}
+
+func (r *memoryRevocationRepository) RevokeClient(clientID string, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[clientID] = clientCutoff(before)
+	return nil
+}
+
+func (r *memoryRevocationRepository) IsRevoked(jti, clientID string, issuedAt time.Time) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.tokens[jti]; ok {
+		return true, nil
+	}
+	before, ok := r.clients[clientID]
+	return ok && issuedAt.Before(before), nil
+}
+
+// clientCutoff rounds a client revocation up to the next whole second, the
+// first iat a token issued after it can carry.
+func clientCutoff(before time.Time) time.Time {
+	return before.Truncate(time.Second).Add(time.Second)
+}
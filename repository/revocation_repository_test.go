@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRevocationRepositoryClientCutoff(t *testing.T) {
+	r := NewMemoryRevocationRepository()
+	cutoff := time.Date(2025, 3, 1, 12, 0, 0, 500_000_000, time.UTC)
+	if err := r.RevokeClient("C1", cutoff); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		clientID string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"issued the second before", "C1", cutoff.Truncate(time.Second).Add(-time.Second), true},
+		{"issued in the same second, before or after", "C1", cutoff.Truncate(time.Second), true},
+		{"issued the second after", "C1", cutoff.Truncate(time.Second).Add(time.Second), false},
+		{"other client", "C2", cutoff.Add(-time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.IsRevoked("jti", tt.clientID, tt.issuedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("IsRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationRepositorySweep(t *testing.T) {
+	r := NewMemoryRevocationRepository().(*memoryRevocationRepository)
+	now := time.Now()
+	r.Revoke("expired", "C1", now.Add(-time.Minute))
+	r.Revoke("live", "C1", now.Add(time.Minute))
+	r.sweep(now)
+
+	if revoked, _ := r.IsRevoked("expired", "C1", now); revoked {
+		t.Error("expired token still recorded after sweep")
+	}
+	if revoked, _ := r.IsRevoked("live", "C1", now); !revoked {
+		t.Error("unexpired revoked token dropped by sweep")
+	}
+}
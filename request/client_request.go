@@ -0,0 +1,19 @@
+package request
+
+type CreateClientRequest struct {
+	ClientID           string   `json:"clientId" binding:"required"`
+	PublicKey          string   `json:"publicKey" binding:"required"`
+	SignatureMode      string   `json:"signatureMode"`
+	SignatureAlgorithm string   `json:"signatureAlgorithm"`
+	SignatureHash      string   `json:"signatureHash"`
+	Products           []string `json:"products"`
+	AllowedIPs         []string `json:"allowedIps"`
+	RatePerSecond      float64  `json:"ratePerSecond"`
+	Burst              int      `json:"burst"`
+	DailyQuota         int      `json:"dailyQuota"`
+	MonthlyQuota       int      `json:"monthlyQuota"`
+}
+
+type RotateClientKeyRequest struct {
+	PublicKey string `json:"publicKey" binding:"required"`
+}
@@ -1,5 +1,6 @@
 package request
 
 type JwtRequest struct {
-	GrantType string `json:"grantType" binding:"required"`
+	GrantType    string `json:"grantType" binding:"required"`
+	RefreshToken string `json:"refreshToken"`
 }
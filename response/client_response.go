@@ -0,0 +1,20 @@
+package response
+
+import "time"
+
+type ClientResponse struct {
+	ClientID           string    `json:"clientId"`
+	Status             string    `json:"status"`
+	Fingerprint        string    `json:"fingerprint,omitempty"`
+	SignatureMode      string    `json:"signatureMode,omitempty"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm,omitempty"`
+	SignatureHash      string    `json:"signatureHash,omitempty"`
+	Products           []string  `json:"products"`
+	AllowedIPs         []string  `json:"allowedIps"`
+	RatePerSecond      float64   `json:"ratePerSecond"`
+	Burst              int       `json:"burst"`
+	DailyQuota         int       `json:"dailyQuota"`
+	MonthlyQuota       int       `json:"monthlyQuota"`
+	CreatedAt          time.Time `json:"createdAt"`
+	UpdatedAt          time.Time `json:"updatedAt"`
+}
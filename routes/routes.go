@@ -1,28 +1,155 @@
 package routes
 
 import (
+	"api-gateway/config"
 	"api-gateway/handlers"
 	"api-gateway/middleware"
 	"api-gateway/repository"
 	"api-gateway/services"
 	"api-gateway/utils"
+	"crypto"
 	"database/sql"
+	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func RegisterRoutes(router *gin.Engine, db *sql.DB) {
+	utils.ConfigureJWT(config.Current().JWT.Issuer, config.Current().JWT.Audience)
+	if err := utils.LoadSigningKeys(config.Current().JWT); err != nil {
+		log.Fatalf("Failed to load JWT keys (see certificate/gateway/README.md): %v", err)
+	}
+
 	tracelogRepo := repository.NewTracelogRepository(db)
 	productRepo := repository.NewProductRepository(db)
 	tracelogService := services.NewTracelogServices(tracelogRepo)
-	externalIDStore := utils.NewExternalIDStore()
-	productServices := services.NewProductService(productRepo, tracelogService)
-	authHandler := handlers.NewAuthHandler(tracelogService, externalIDStore, productServices)
-	proxyHandler := handlers.NewProxyHandler(tracelogService)
-	router.POST("/auth/login", authHandler.Login)
+	replayStore := newReplayStore(db)
+	clientService := newClientService(db)
+	productServices := services.NewProductService(productRepo, tracelogService, clientService, config.Current().ProductCache)
+	refreshTokenStore := newRefreshTokenStore(db)
+	keyRegistry := newKeyRegistry(clientService)
+	tokenService := services.NewTokenService(newRevocationRepository(db))
+	authHandler := handlers.NewAuthHandler(tracelogService, replayStore, productServices, refreshTokenStore, tokenService, keyRegistry, clientService)
+	adminHandler := handlers.NewAdminHandler(tracelogService, tokenService, keyRegistry, clientService, productServices)
+	routeService := services.NewRouteService(config.Current().Routes, productServices)
+	clientSecretRepo := repository.NewClientSecretRepository(db)
+	clientSecretService := services.NewClientSecretService(clientSecretRepo, clientService.All)
+	responseSigningService := services.NewResponseSigningService(clientSecretService, clientService.All, loadResponseSigningKey())
+	proxyHandler := handlers.NewProxyHandler(tracelogService, routeService, responseSigningService, services.NewUpstreamService(), maxSignedBodyBytes())
+	rateLimitService := services.NewRateLimitService(newRateLimitStore(db), config.Current().RateLimit)
+	clientCert := middleware.ClientCertMiddleware(clientService.All)
+	router.POST("/auth/login", middleware.LoginRateLimitMiddleware(rateLimitService), clientCert, authHandler.Login)
 	router.POST("/generateJWT", handlers.GenerateSignatureHandler)
+	router.GET("/.well-known/jwks.json", handlers.JWKSHandler)
+	router.POST("/auth/logout", middleware.JWTAuthMiddleware(tokenService), authHandler.Logout)
+	router.POST("/auth/introspect", middleware.BasicAuthMiddleware(config.Current().Introspection.Clients), authHandler.Introspect)
+
+	admin := router.Group("/admin")
+	admin.Use(middleware.AdminAuthMiddleware(config.Current().Admin.APIKeys))
+	admin.POST("/clients/:clientId/revoke-tokens", adminHandler.RevokeClientTokens)
+	admin.GET("/keys", adminHandler.ListClientKeys)
+	admin.GET("/clients", adminHandler.ListClients)
+	admin.POST("/clients", adminHandler.CreateClient)
+	admin.POST("/clients/:clientId/suspend", adminHandler.SuspendClient)
+	admin.POST("/clients/:clientId/activate", adminHandler.ActivateClient)
+	admin.POST("/clients/:clientId/rotate-key", adminHandler.RotateClientKey)
+	admin.PUT("/clients/:clientId/products/:product", adminHandler.GrantProduct)
+	admin.DELETE("/clients/:clientId/products/:product", adminHandler.RevokeProduct)
+	admin.GET("/products/cache", adminHandler.ProductCacheStats)
+	admin.DELETE("/products/cache", adminHandler.InvalidateProductCache)
+
 	secure := router.Group("/secure")
-	secure.Use(middleware.JWTAuthMiddleware())
+	secure.Use(clientCert)
+	secure.Use(middleware.JWTAuthMiddleware(tokenService))
 	secure.Use(middleware.BodyCacheMiddleware())
+	secure.Use(middleware.ProductAvailabilityMiddleware(productServices))
+	secure.Use(middleware.EntitlementMiddleware(tracelogService, productServices))
+	secure.Use(middleware.RouteMiddleware(routeService))
+	secure.Use(middleware.ClientRateLimitMiddleware(rateLimitService, clientService))
+	secure.Use(middleware.SecureProxy(tracelogService, clientSecretService, keyRegistry, clientService.All, replayStore))
 	secure.Any("/*proxyPath", proxyHandler.ProxyHandler)
 }
+
+// newRevocationRepository picks the revocation store configured in store.driver.
+func newRevocationRepository(db *sql.DB) repository.RevocationRepository {
+	if config.Current().Store.Driver == "memory" {
+		return repository.NewMemoryRevocationRepository()
+	}
+	return repository.NewRevocationRepository(db)
+}
+
+// newRefreshTokenStore picks the refresh token store configured in store.driver.
+func newRefreshTokenStore(db *sql.DB) repository.RefreshTokenStore {
+	if config.Current().Store.Driver == "memory" {
+		return repository.NewMemoryRefreshTokenStore()
+	}
+	return repository.NewRefreshTokenStore(db)
+}
+
+// newRateLimitStore picks the rate limit counters configured in store.driver.
+func newRateLimitStore(db *sql.DB) repository.RateLimitStore {
+	if config.Current().Store.Driver == "memory" {
+		return repository.NewMemoryRateLimitStore(time.Hour)
+	}
+	return repository.NewRateLimitStore(db)
+}
+
+// newReplayStore picks the X-EXTERNAL-ID replay store configured in store.driver.
+func newReplayStore(db *sql.DB) repository.ReplayStore {
+	if config.Current().Store.Driver == "memory" {
+		maxEntries := config.Current().Store.ReplayMaxEntries
+		if maxEntries <= 0 {
+			maxEntries = 100000
+		}
+		return repository.NewMemoryReplayStore(maxEntries, time.Minute)
+	}
+	return repository.NewReplayStore(db)
+}
+
+// loadResponseSigningKey loads the gateway key for response_signature "gateway", if configured.
+func loadResponseSigningKey() crypto.Signer {
+	path := config.Current().ResponseSigning.PrivateKeyPath
+	if path == "" {
+		return nil
+	}
+	key, err := utils.LoadPrivateKey(path)
+	if err != nil {
+		log.Fatalf("Failed to load response signing key: %v", err)
+	}
+	return key
+}
+
+func maxSignedBodyBytes() int64 {
+	if max := config.Current().ResponseSigning.MaxBodyBytes; max > 0 {
+		return max
+	}
+	return 10 << 20
+}
+
+// newClientService loads the clients registered in the database next to those
+// of config.json. Without the database only config.json clients are served.
+func newClientService(db *sql.DB) services.ClientService {
+	clients := services.NewClientService(repository.NewClientRepository(db), repository.NewProductRepository(db), config.Current)
+	if err := clients.Refresh(); err != nil {
+		log.Printf("Failed to load registered clients: %v", err)
+	}
+	clients.Watch(30 * time.Second)
+	return clients
+}
+
+// newKeyRegistry parses every client public key up front, reporting malformed
+// ones now rather than at the client's first login, then watches for changes.
+func newKeyRegistry(clients services.ClientService) *utils.KeyRegistry {
+	warnDays := config.Current().CertExpiryWarningDays
+	if warnDays <= 0 {
+		warnDays = 30
+	}
+	registry := utils.NewKeyRegistry(clients.All, time.Duration(warnDays)*24*time.Hour)
+	for clientID, err := range registry.Refresh() {
+		log.Printf("Failed to load public key of client %s: %v", clientID, err)
+	}
+	registry.WarnExpiring(time.Now())
+	registry.Watch(30 * time.Second)
+	return registry
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"api-gateway/model"
+	"api-gateway/repository"
+)
+
+type ClientSecretService interface {
+	// GetSecrets returns the client's HMAC secrets, the one to sign with first.
+	GetSecrets(clientID string) ([]string, error)
+}
+
+type clientSecretService struct {
+	repo    repository.ClientSecretRepository
+	clients func() map[string]model.ClientConfig
+}
+
+// NewClientSecretService serves secrets from the client_secret table, newest
+// first, then those in config.json. Rotations go through the table, so its
+// newest secret is the current one.
+func NewClientSecretService(r repository.ClientSecretRepository, clients func() map[string]model.ClientConfig) ClientSecretService {
+	return &clientSecretService{repo: r, clients: clients}
+}
+
+func (s *clientSecretService) GetSecrets(clientID string) ([]string, error) {
+	stored, err := s.repo.GetActiveSecrets(clientID)
+	if err != nil {
+		return nil, err
+	}
+	return append(stored, s.clients()[clientID].Secrets...), nil
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"api-gateway/model"
+	"api-gateway/repository"
+	"api-gateway/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrClientNotRegistered = errors.New("client not registered")
+	ErrClientSuspended     = errors.New("client suspended")
+	ErrClientExists        = errors.New("client already registered")
+	ErrInvalidClient       = errors.New("invalid client")
+)
+
+const (
+	ClientStatusActive    = "active"
+	ClientStatusSuspended = "suspended"
+)
+
+// maxClientIDLength is the width of clients.client_id.
+const maxClientIDLength = 20
+
+// ClientService merges the clients of config.json with those registered in
+// the clients table, which take precedence for the same client ID. The merged
+// view is cached and rebuilt periodically, after every change and when the
+// config is reloaded.
+type ClientService interface {
+	Get(clientID string) (model.ClientConfig, error)
+	// All returns the merged view, shared by every caller: do not modify it.
+	All() map[string]model.ClientConfig
+	Refresh() error
+	Watch(interval time.Duration)
+	List() ([]model.Client, error)
+	Create(client model.Client) error
+	SetStatus(clientID, status string) error
+	RotateKey(clientID, publicKey string) error
+}
+
+type clientService struct {
+	repo     repository.ClientRepository
+	products repository.ProductRepository
+	config   func() *model.Config
+
+	mu         sync.RWMutex
+	registered map[string]model.Client
+	merged     map[string]model.ClientConfig
+	mergedFrom *model.Config // The config merged was built from
+}
+
+// NewClientService merges the registered clients into the clients section of
+// config, which is read again on every call so reloads are seen. Products are
+// read to check that new clients are only granted ones that exist.
+func NewClientService(r repository.ClientRepository, p repository.ProductRepository, config func() *model.Config) ClientService {
+	return &clientService{repo: r, products: p, config: config, registered: map[string]model.Client{}}
+}
+
+// Watch reloads the registered clients every interval.
+func (s *clientService) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := s.Refresh(); err != nil {
+				log.Printf("Failed to reload clients: %v", err)
+			}
+		}
+	}()
+}
+
+// Get returns the merged settings of an active client.
+func (s *clientService) Get(clientID string) (model.ClientConfig, error) {
+	client, ok := s.All()[clientID]
+	if !ok {
+		return model.ClientConfig{}, ErrClientNotRegistered
+	}
+	if client.Status == ClientStatusSuspended {
+		return model.ClientConfig{}, ErrClientSuspended
+	}
+	return client, nil
+}
+
+func (s *clientService) All() map[string]model.ClientConfig {
+	config := s.config()
+	s.mu.RLock()
+	merged, from := s.merged, s.mergedFrom
+	s.mu.RUnlock()
+	if merged != nil && from == config {
+		return merged
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.merge(config)
+	return s.merged
+}
+
+// merge rebuilds the merged view from config. Callers hold s.mu.
+func (s *clientService) merge(config *model.Config) {
+	var configured map[string]model.ClientConfig
+	if config != nil {
+		configured = config.Clients
+	}
+	merged := maps.Clone(configured)
+	if merged == nil {
+		merged = map[string]model.ClientConfig{}
+	}
+	for clientID, client := range s.registered {
+		merged[clientID] = client.Apply(merged[clientID])
+	}
+	s.merged, s.mergedFrom = merged, config
+}
+
+// Refresh reloads the registered clients; on failure the previous ones stay.
+func (s *clientService) Refresh() error {
+	clients, err := s.repo.GetAll()
+	if err != nil {
+		return err
+	}
+	registered := make(map[string]model.Client, len(clients))
+	for _, client := range clients {
+		registered[client.ClientID] = client
+	}
+	config := s.config()
+	s.mu.Lock()
+	s.registered = registered
+	s.merge(config)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *clientService) List() ([]model.Client, error) {
+	return s.repo.GetAll()
+}
+
+func (s *clientService) Create(client model.Client) error {
+	if client.ClientID == "" || utf8.RuneCountInString(client.ClientID) > maxClientIDLength {
+		return fmt.Errorf("%w: client ID must be 1 to %d characters", ErrInvalidClient, maxClientIDLength)
+	}
+	switch client.SignatureMode {
+	case "", "hmac", "asymmetric":
+	default:
+		return fmt.Errorf("%w: unknown signature mode %q, expected hmac or asymmetric", ErrInvalidClient, client.SignatureMode)
+	}
+	if err := validateClientKey(client.PublicKey); err != nil {
+		return err
+	}
+	if _, err := utils.ParseSignatureOptions(client.SignatureAlgorithm, client.SignatureHash); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidClient, err)
+	}
+	for _, ip := range client.AllowedIPs {
+		_, prefixErr := netip.ParsePrefix(ip)
+		_, addrErr := netip.ParseAddr(ip)
+		if prefixErr != nil && addrErr != nil {
+			return fmt.Errorf("%w: allowed IP %q is neither an IP nor a CIDR", ErrInvalidClient, ip)
+		}
+	}
+	client.Products = slices.Compact(slices.Sorted(slices.Values(client.Products)))
+	for _, product := range client.Products {
+		_, err := s.products.GetProduct(product)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: unknown product %q", ErrInvalidClient, product)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if client.Status == "" {
+		client.Status = ClientStatusActive
+	}
+	err := s.repo.Create(client)
+	if errors.Is(err, repository.ErrClientExists) {
+		return ErrClientExists
+	}
+	if err != nil {
+		return err
+	}
+	return s.Refresh()
+}
+
+func (s *clientService) SetStatus(clientID, status string) error {
+	if status != ClientStatusActive && status != ClientStatusSuspended {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidClient, status)
+	}
+	if err := s.repo.UpdateStatus(clientID, status); err != nil {
+		return err
+	}
+	return s.Refresh()
+}
+
+func (s *clientService) RotateKey(clientID, publicKey string) error {
+	if err := validateClientKey(publicKey); err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePublicKey(clientID, publicKey); err != nil {
+		return err
+	}
+	return s.Refresh()
+}
+
+func validateClientKey(publicKey string) error {
+	if _, err := utils.ParsePublicKeyPEM([]byte(publicKey)); err != nil {
+		return fmt.Errorf("%w: public key: %v", ErrInvalidClient, err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"api-gateway/model"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+type staticClients []model.Client
+
+func (r staticClients) GetAll() ([]model.Client, error)                  { return r, nil }
+func (r staticClients) Create(client model.Client) error                 { return nil }
+func (r staticClients) UpdateStatus(clientID, status string) error       { return nil }
+func (r staticClients) UpdatePublicKey(clientID, publicKey string) error { return nil }
+
+// knownProducts holds the names of the products in master_product.
+type knownProducts []string
+
+func (r knownProducts) GetProduct(p string) (*model.Product, error) {
+	for _, name := range r {
+		if name == p {
+			return &model.Product{ProductName: p}, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r knownProducts) IsEntitled(product, clientID string) (bool, error) { return false, nil }
+func (r knownProducts) Grant(product, clientID string) error              { return nil }
+func (r knownProducts) Revoke(product, clientID string) error             { return nil }
+
+func TestClientServiceAll(t *testing.T) {
+	var current atomic.Pointer[model.Config]
+	current.Store(&model.Config{Clients: map[string]model.ClientConfig{"C1": {SignatureMode: "hmac"}}})
+	s := NewClientService(staticClients{{ClientID: "C2", Status: ClientStatusActive}}, knownProducts{}, current.Load)
+	if err := s.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	first := s.All()
+	if len(first) != 2 {
+		t.Fatalf("All() = %v, want config and registered clients", first)
+	}
+	if reflect.ValueOf(s.All()).UnsafePointer() != reflect.ValueOf(first).UnsafePointer() {
+		t.Error("All() rebuilt the view without a change")
+	}
+
+	current.Store(&model.Config{Clients: map[string]model.ClientConfig{"C3": {}}})
+	reloaded := s.All()
+	if _, ok := reloaded["C1"]; ok {
+		t.Error("All() still has a client removed by the config reload")
+	}
+	if _, ok := reloaded["C3"]; !ok {
+		t.Error("All() misses a client added by the config reload")
+	}
+	if _, ok := reloaded["C2"]; !ok {
+		t.Error("All() lost the registered client on config reload")
+	}
+}
+
+func TestClientServiceKeepsConfigSettings(t *testing.T) {
+	var current atomic.Pointer[model.Config]
+	current.Store(&model.Config{Clients: map[string]model.ClientConfig{"C1": {
+		Products:   []string{"P1"},
+		AllowedIPs: []string{"10.0.0.0/8"},
+		Limits:     model.ClientLimits{RatePerSecond: 5},
+	}}})
+	registered := staticClients{{ClientID: "C1", Status: ClientStatusActive, Products: []string{"P2"}}}
+	s := NewClientService(registered, knownProducts{}, current.Load)
+	if err := s.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := s.All()["C1"]
+	if !reflect.DeepEqual(got.Products, []string{"P1"}) {
+		t.Errorf("Products = %v, want the config.json ones only", got.Products)
+	}
+	if !reflect.DeepEqual(got.AllowedIPs, []string{"10.0.0.0/8"}) {
+		t.Errorf("AllowedIPs = %v, want the config.json ones kept", got.AllowedIPs)
+	}
+	if got.Limits.RatePerSecond != 5 {
+		t.Errorf("Limits = %+v, want the config.json ones kept", got.Limits)
+	}
+}
+
+func TestClientServiceCreateValidation(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	s := NewClientService(staticClients{}, knownProducts{"P1"}, func() *model.Config { return &model.Config{} })
+
+	tests := []struct {
+		name    string
+		client  model.Client
+		wantErr error
+	}{
+		{"valid", model.Client{ClientID: "C1", PublicKey: publicKey, SignatureMode: "asymmetric", Products: []string{"P1", "P1"}}, nil},
+		{"empty client ID", model.Client{PublicKey: publicKey}, ErrInvalidClient},
+		{"client ID too long", model.Client{ClientID: "C123456789012345678901", PublicKey: publicKey}, ErrInvalidClient},
+		{"unknown signature mode", model.Client{ClientID: "C1", PublicKey: publicKey, SignatureMode: "rsa"}, ErrInvalidClient},
+		{"unknown product", model.Client{ClientID: "C1", PublicKey: publicKey, Products: []string{"P1", "P9"}}, ErrInvalidClient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Create(tt.client); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Create() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,34 +1,277 @@
 package services
 
 import (
+	"api-gateway/model"
 	"api-gateway/repository"
+	"database/sql"
 	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
 )
 
+var ErrProductNotFound = errors.New("product not found")
+
+// ProductUnavailableError reports a product that exists but cannot be used.
+// HTTPStatus gives the documented response code for its state:
+//
+//	maintenance 503 Service Unavailable, with Retry-After when the end is known
+//	suspended   403 Forbidden
+//	retired     410 Gone
+//
+// Unknown products are ErrProductNotFound, answered with 404 Not Found.
+type ProductUnavailableError struct {
+	Product    string
+	State      string
+	Message    string        // Partner facing
+	RetryAfter time.Duration // Maintenance only, zero when the end is unknown
+}
+
+func (e *ProductUnavailableError) Error() string {
+	return fmt.Sprintf("product %s is %s", e.Product, e.State)
+}
+
+// RetryAfterSeconds is the Retry-After value, zero when there is none.
+func (e *ProductUnavailableError) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+func (e *ProductUnavailableError) HTTPStatus() int {
+	switch e.State {
+	case model.ProductMaintenance:
+		return http.StatusServiceUnavailable
+	case model.ProductRetired:
+		return http.StatusGone
+	}
+	return http.StatusForbidden
+}
+
+var defaultStateMessages = map[string]string{
+	model.ProductMaintenance: "Product is under maintenance, please try again later.",
+	model.ProductSuspended:   "Product is temporarily suspended.",
+	model.ProductRetired:     "Product has been retired.",
+}
+
 type ProductService interface {
-	IsProductMain(p string, c string) (bool, error)
+	CheckAvailability(p string, c string) error
+	GetProduct(p string) (*model.Product, error)
+	IsEntitled(p string, c string) (bool, error)
+	Grant(p string, c string) error
+	Revoke(p string, c string) error
+	Invalidate(p string)
+	CacheStats() ProductCacheStats
+}
+
+// ProductCacheStats counts how product lookups were answered since startup.
+type ProductCacheStats struct {
+	Hits         uint64 `json:"hits"`
+	NegativeHits uint64 `json:"negativeHits"` // Answered "not found" from the cache
+	Misses       uint64 `json:"misses"`
+	StaleServed  uint64 `json:"staleServed"` // Expired entries served while the database failed or was slow
+	Errors       uint64 `json:"errors"`
+	Entries      int    `json:"entries"`
+}
+
+type productCacheEntry struct {
+	product   *model.Product // nil for a product that does not exist
+	fetchedAt time.Time
+}
+
+func (e productCacheEntry) result() (*model.Product, error) {
+	if e.product == nil {
+		return nil, sql.ErrNoRows
+	}
+	return e.product, nil
 }
 
 type productService struct {
 	productRepository repository.ProductRepository
 	tracelogServices  TracelogServices
+	clients           ClientService
+	cacheConfig       model.ProductCacheConfig
+
+	mu         sync.Mutex
+	cache      map[string]productCacheEntry
+	inflight   map[string]*productFetch
+	generation uint64 // Bumped by Invalidate
+	stats      ProductCacheStats
 }
 
-func NewProductService(r repository.ProductRepository, t TracelogServices) ProductService {
-	return &productService{productRepository: r, tracelogServices: t}
+// NewProductService checks entitlements against the client_product table and
+// the products listed for each client in config.json, both as seen by clients.
+// Product lookups go through a read-through cache configured by cache.
+func NewProductService(r repository.ProductRepository, t TracelogServices, clients ClientService, cache model.ProductCacheConfig) ProductService {
+	return &productService{productRepository: r, tracelogServices: t, clients: clients, cacheConfig: cache,
+		cache: map[string]productCacheEntry{}, inflight: map[string]*productFetch{}}
 }
 
-func (s productService) IsProductMain(p string, c string) (bool, error) {
-	product, err := s.productRepository.GetProduct(p)
+// CheckAvailability returns nil when product p is active, ErrProductNotFound
+// when it does not exist and a *ProductUnavailableError otherwise.
+func (s *productService) CheckAvailability(p string, c string) error {
+	product, err := s.GetProduct(p)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.tracelogServices.Log("PRODUCT STATE", c, p, "Product not found")
+		return ErrProductNotFound
+	}
 	if err != nil {
-		s.tracelogServices.Log("IS PRODUCT MAIN", c, p, err.Error())
-		return false, err
+		s.tracelogServices.Log("PRODUCT STATE", c, p, err.Error())
+		return err
 	}
-	if product.Recid.Valid && product.Recid.String != "" {
-		s.tracelogServices.Log("IS PRODUCT MAIN", c, p, "Product Tidak Main")
-		return false, errors.New("product tidak main")
+
+	state, retryAfter := product.StateAt(time.Now())
+	if state == model.ProductActive {
+		return nil
+	}
+	message := product.StatusMessage.String
+	if message == "" {
+		message = defaultStateMessages[state]
+	}
+	if message == "" {
+		// Unknown states are not served
+		state, message = model.ProductSuspended, defaultStateMessages[model.ProductSuspended]
+	}
+	s.tracelogServices.Log("PRODUCT STATE", c, p, fmt.Sprintf("product %s is %s", p, state))
+	return &ProductUnavailableError{Product: p, State: state, Message: message, RetryAfter: retryAfter}
+}
+
+// GetProduct serves p from the cache while it is fresh and reads it from the
+// database otherwise, with one read per product however many requests miss.
+// Unknown products are cached too, for the shorter negative TTL. An expired
+// entry younger than the stale limit is served when the database fails or
+// does not answer within the refresh wait; the read then completes in the
+// background.
+func (s *productService) GetProduct(p string) (*model.Product, error) {
+	now := time.Now()
+	s.mu.Lock()
+	entry, cached := s.cache[p]
+	if cached && now.Sub(entry.fetchedAt) < s.ttl(entry) {
+		if entry.product == nil {
+			s.stats.NegativeHits++
+		} else {
+			s.stats.Hits++
+		}
+		s.mu.Unlock()
+		return entry.result()
+	}
+	s.stats.Misses++
+	fetch := s.fetch(p)
+	s.mu.Unlock()
+
+	stale := cached && now.Sub(entry.fetchedAt) < s.cacheConfig.StaleDuration()
+	if stale {
+		wait := time.NewTimer(s.cacheConfig.RefreshWaitDuration())
+		defer wait.Stop()
+		select {
+		case <-fetch.done:
+		case <-wait.C:
+			s.mu.Lock()
+			s.stats.StaleServed++
+			s.mu.Unlock()
+			return entry.result()
+		}
+	} else {
+		<-fetch.done
+	}
+
+	if fetch.err != nil && !errors.Is(fetch.err, sql.ErrNoRows) && stale {
+		s.mu.Lock()
+		s.stats.StaleServed++
+		s.mu.Unlock()
+		return entry.result()
+	}
+	return fetch.product, fetch.err
+}
+
+// productFetch is a database read shared by every lookup of one product.
+type productFetch struct {
+	done    chan struct{}
+	product *model.Product
+	err     error
+}
+
+// fetch joins the read of p in flight or starts one. Its result is cached only
+// if nothing was invalidated meanwhile. Callers hold s.mu.
+func (s *productService) fetch(p string) *productFetch {
+	if f, ok := s.inflight[p]; ok {
+		return f
+	}
+	f := &productFetch{done: make(chan struct{})}
+	s.inflight[p] = f
+	generation, started := s.generation, time.Now()
+	go func() {
+		product, err := s.productRepository.GetProduct(p)
+		s.mu.Lock()
+		if s.inflight[p] == f {
+			delete(s.inflight, p)
+		}
+		switch {
+		case err != nil && !errors.Is(err, sql.ErrNoRows):
+			s.stats.Errors++
+		case s.generation == generation:
+			s.cache[p] = productCacheEntry{product: product, fetchedAt: started}
+		}
+		f.product, f.err = product, err
+		s.mu.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+// ttl is how long entry is served without asking the database. Callers hold s.mu.
+func (s *productService) ttl(entry productCacheEntry) time.Duration {
+	if entry.product == nil {
+		return s.cacheConfig.NegativeTTLDuration()
+	}
+	return s.cacheConfig.TTLDuration()
+}
+
+// Invalidate drops p from the cache, or every product when p is empty. Reads
+// already in flight are not cached, so they cannot bring back the old value.
+func (s *productService) Invalidate(p string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	if p == "" {
+		clear(s.cache)
+		clear(s.inflight)
+		return
+	}
+	delete(s.cache, p)
+	delete(s.inflight, p)
+}
+
+func (s *productService) CacheStats() ProductCacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Entries = len(s.cache)
+	return stats
+}
+
+// IsEntitled reports whether client c may use product p. Clients are entitled
+// to nothing unless granted.
+func (s *productService) IsEntitled(p string, c string) (bool, error) {
+	if slices.Contains(s.clients.All()[c].Products, p) {
+		return true, nil
+	}
+	return s.productRepository.IsEntitled(p, c)
+}
+
+// Grant and Revoke reload the clients, whose products include the granted
+// ones, so the change applies to the next request.
+func (s *productService) Grant(p string, c string) error {
+	if err := s.productRepository.Grant(p, c); err != nil {
+		return err
+	}
+	return s.clients.Refresh()
+}
+
+func (s *productService) Revoke(p string, c string) error {
+	if err := s.productRepository.Revoke(p, c); err != nil {
+		return err
 	}
-	s.tracelogServices.Log("IS PRODUCT MAIN", c, p, fmt.Sprintf("product %s main dan aktif", p))
-	return true, nil
+	return s.clients.Refresh()
 }
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"api-gateway/model"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type nopTracelog struct{}
+
+func (nopTracelog) Log(proses, ca, product, message string) {}
+
+// blockingProducts answers GetProduct once release is closed.
+type blockingProducts struct {
+	calls   atomic.Int32
+	release chan struct{}
+	status  atomic.Value // string
+	err     error
+}
+
+func (r *blockingProducts) GetProduct(p string) (*model.Product, error) {
+	r.calls.Add(1)
+	<-r.release
+	if r.err != nil {
+		return nil, r.err
+	}
+	status, _ := r.status.Load().(string)
+	return &model.Product{ProductName: p, Status: sql.NullString{String: status, Valid: status != ""}}, nil
+}
+
+func (r *blockingProducts) IsEntitled(product, clientID string) (bool, error) { return false, nil }
+func (r *blockingProducts) Grant(product, clientID string) error              { return nil }
+func (r *blockingProducts) Revoke(product, clientID string) error             { return nil }
+
+func newTestProductService(repo *blockingProducts) *productService {
+	return NewProductService(repo, nopTracelog{}, nil, model.ProductCacheConfig{RefreshWaitMs: 20}).(*productService)
+}
+
+func TestGetProductCoalescesMisses(t *testing.T) {
+	repo := &blockingProducts{release: make(chan struct{})}
+	s := newTestProductService(repo)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.GetProduct("pay"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	for repo.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(repo.release)
+	wg.Wait()
+
+	if calls := repo.calls.Load(); calls != 1 {
+		t.Fatalf("repository read %d times, want 1", calls)
+	}
+}
+
+func TestGetProductInvalidateWinsOverInFlightRead(t *testing.T) {
+	repo := &blockingProducts{release: make(chan struct{})}
+	repo.status.Store("active")
+	s := newTestProductService(repo)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.GetProduct("pay")
+	}()
+	for repo.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s.Invalidate("pay")
+	repo.status.Store("retired")
+	close(repo.release)
+	<-done
+
+	product, err := s.GetProduct("pay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Status.String != "retired" {
+		t.Fatalf("status = %q, want the value read after Invalidate", product.Status.String)
+	}
+}
+
+func TestGetProductServesStale(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error // nil: the database is slow instead
+	}{
+		{"database slow", nil},
+		{"database failing", errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &blockingProducts{release: make(chan struct{}), err: tt.err}
+			if tt.err != nil {
+				close(repo.release)
+			}
+			s := newTestProductService(repo)
+			s.cache["pay"] = productCacheEntry{product: &model.Product{ProductName: "pay"}, fetchedAt: time.Now().Add(-2 * time.Minute)}
+
+			start := time.Now()
+			product, err := s.GetProduct("pay")
+			if err != nil || product == nil {
+				t.Fatalf("GetProduct() = %v, %v, want the expired entry", product, err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("stale entry served after %v", elapsed)
+			}
+			if stats := s.CacheStats(); stats.StaleServed != 1 {
+				t.Fatalf("StaleServed = %d, want 1", stats.StaleServed)
+			}
+			if tt.err == nil {
+				close(repo.release)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"api-gateway/model"
+	"api-gateway/repository"
+	"log"
+	"math"
+	"time"
+)
+
+// RateLimitDecision is the outcome of the limits applied to one request, with
+// what the X-RateLimit-* headers report. Limit is zero when nothing applied.
+type RateLimitDecision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // Until the limit is fully available again
+	RetryAfter time.Duration // Set when not allowed
+}
+
+// RateLimitService applies token bucket rate limits and daily/monthly quotas.
+// When several limits apply the first one exceeded denies the request and the
+// limits charged before it are refunded, so a denied request counts against
+// none of them; otherwise the one with the fewest requests left is reported.
+type RateLimitService interface {
+	CheckLogin(ip string) (RateLimitDecision, error)
+	CheckClient(clientID string, limits model.ClientLimits, route *model.RouteConfig) (RateLimitDecision, error)
+}
+
+// limitCheck charges one limit and returns how to refund the charge.
+type limitCheck func(now time.Time) (RateLimitDecision, func() error, error)
+
+type rateLimitService struct {
+	store  repository.RateLimitStore
+	config model.RateLimitingConfig
+}
+
+func NewRateLimitService(store repository.RateLimitStore, config model.RateLimitingConfig) RateLimitService {
+	return &rateLimitService{store: store, config: config}
+}
+
+// CheckLogin limits /auth/login per source IP.
+func (s *rateLimitService) CheckLogin(ip string) (RateLimitDecision, error) {
+	return s.check(time.Now(), s.take("login:"+ip, s.config.Login))
+}
+
+// CheckClient limits /secure per client, using the client's own rate or the
+// configured default, per client on the route when it has a rate limit, and
+// counts the request against the client's quotas.
+func (s *rateLimitService) CheckClient(clientID string, limits model.ClientLimits, route *model.RouteConfig) (RateLimitDecision, error) {
+	clientLimit := model.RateLimitConfig{RatePerSecond: limits.RatePerSecond, Burst: limits.Burst}
+	if clientLimit.RatePerSecond <= 0 {
+		clientLimit = s.config.Client
+	}
+	checks := []limitCheck{s.take("client:"+clientID, clientLimit)}
+	if route != nil {
+		checks = append(checks, s.take("route:"+route.Name+":"+clientID, route.RateLimit))
+	}
+	checks = append(checks,
+		s.consume("daily:"+clientID, limits.DailyQuota, nextDay),
+		s.consume("monthly:"+clientID, limits.MonthlyQuota, nextMonth),
+	)
+	return s.check(time.Now(), checks...)
+}
+
+func (s *rateLimitService) check(now time.Time, checks ...limitCheck) (RateLimitDecision, error) {
+	result := RateLimitDecision{Allowed: true}
+	var refunds []func() error
+	refund := func() {
+		for _, undo := range refunds {
+			if err := undo(); err != nil {
+				log.Printf("Failed to refund rate limit: %v", err)
+			}
+		}
+	}
+	for _, check := range checks {
+		decision, undo, err := check(now)
+		if err != nil {
+			refund()
+			return RateLimitDecision{}, err
+		}
+		if !decision.Allowed {
+			refund()
+			return decision, nil
+		}
+		if undo != nil {
+			refunds = append(refunds, undo)
+		}
+		if decision.Limit > 0 && (result.Limit == 0 || decision.Remaining < result.Remaining) {
+			result = decision
+		}
+	}
+	return result, nil
+}
+
+func (s *rateLimitService) take(key string, limit model.RateLimitConfig) limitCheck {
+	return func(now time.Time) (RateLimitDecision, func() error, error) {
+		if limit.RatePerSecond <= 0 {
+			return RateLimitDecision{Allowed: true}, nil, nil
+		}
+		burst := limit.BurstSize()
+		tokens, allowed, err := s.store.TakeToken(key, limit.RatePerSecond, burst, now)
+		if err != nil {
+			return RateLimitDecision{}, nil, err
+		}
+		decision := RateLimitDecision{
+			Allowed:   allowed,
+			Limit:     burst,
+			Remaining: int(tokens),
+			Reset:     secondsDuration((float64(burst) - tokens) / limit.RatePerSecond),
+		}
+		if !allowed {
+			decision.RetryAfter = secondsDuration((1 - tokens) / limit.RatePerSecond)
+		}
+		return decision, func() error { return s.store.ReturnToken(key, burst) }, nil
+	}
+}
+
+func (s *rateLimitService) consume(key string, limit int, period func(time.Time) time.Time) limitCheck {
+	return func(now time.Time) (RateLimitDecision, func() error, error) {
+		if limit <= 0 {
+			return RateLimitDecision{Allowed: true}, nil, nil
+		}
+		periodEnd := period(now)
+		used, allowed, err := s.store.ConsumeQuota(key, limit, periodEnd)
+		if err != nil {
+			return RateLimitDecision{}, nil, err
+		}
+		decision := RateLimitDecision{Allowed: allowed, Limit: limit, Remaining: max(limit-used, 0), Reset: periodEnd.Sub(now)}
+		if !allowed {
+			decision.RetryAfter = decision.Reset
+		}
+		return decision, func() error { return s.store.ReturnQuota(key, periodEnd) }, nil
+	}
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
+
+// nextDay is the next local midnight, when daily quotas reset.
+func nextDay(now time.Time) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+}
+
+// nextMonth is the start of the next local month, when monthly quotas reset.
+func nextMonth(now time.Time) time.Time {
+	y, m, _ := now.Date()
+	return time.Date(y, m+1, 1, 0, 0, 0, 0, now.Location())
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"api-gateway/model"
+	"api-gateway/repository"
+	"testing"
+	"time"
+)
+
+func TestNextDay(t *testing.T) {
+	tests := []struct {
+		now, want time.Time
+	}{
+		{time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC), time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 2, 28, 8, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := nextDay(tt.now); !got.Equal(tt.want) {
+			t.Errorf("nextDay(%v) = %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestNextMonth(t *testing.T) {
+	tests := []struct {
+		now, want time.Time
+	}{
+		{time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 1, 31, 23, 0, 0, 0, time.UTC), time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 2, 29, 10, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := nextMonth(tt.now); !got.Equal(tt.want) {
+			t.Errorf("nextMonth(%v) = %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestCheckClientRefundsOnDenial(t *testing.T) {
+	s := NewRateLimitService(repository.NewMemoryRateLimitStore(time.Hour), model.RateLimitingConfig{})
+	limits := model.ClientLimits{RatePerSecond: 0.001, Burst: 2, DailyQuota: 10, MonthlyQuota: 1}
+
+	if d, err := s.CheckClient("C1", limits, nil); err != nil || !d.Allowed {
+		t.Fatalf("first request: %+v, %v", d, err)
+	}
+	// Denied by the monthly quota: the client token and daily quota are refunded
+	d, err := s.CheckClient("C1", limits, nil)
+	if err != nil || d.Allowed {
+		t.Fatalf("second request: %+v, %v", d, err)
+	}
+
+	limits.MonthlyQuota = 0
+	d, err = s.CheckClient("C1", limits, nil)
+	if err != nil || !d.Allowed {
+		t.Fatalf("third request: %+v, %v", d, err)
+	}
+	if d.Remaining != 0 {
+		t.Errorf("Remaining = %d, want 0 tokens after two allowed requests", d.Remaining)
+	}
+}
+
+func TestCheckClientRouteDenialRefundsClientToken(t *testing.T) {
+	s := NewRateLimitService(repository.NewMemoryRateLimitStore(time.Hour), model.RateLimitingConfig{})
+	limits := model.ClientLimits{RatePerSecond: 0.001, Burst: 3}
+	route := &model.RouteConfig{Name: "pay", RateLimit: model.RateLimitConfig{RatePerSecond: 0.001, Burst: 1}}
+
+	if d, _ := s.CheckClient("C1", limits, route); !d.Allowed {
+		t.Fatal("first request denied")
+	}
+	for i := 0; i < 3; i++ {
+		if d, _ := s.CheckClient("C1", limits, route); d.Allowed {
+			t.Fatalf("request %d allowed over the route limit", i)
+		}
+	}
+	// Only the allowed request used a client token
+	d, _ := s.CheckClient("C1", limits, nil)
+	if !d.Allowed || d.Remaining != 1 {
+		t.Errorf("client bucket after route denials: %+v, want allowed with 1 left", d)
+	}
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"api-gateway/model"
+	"api-gateway/utils"
+	"crypto"
+	"errors"
+	"fmt"
+)
+
+type ResponseSigningService interface {
+	Enabled(clientID string) bool
+	Sign(clientID, method, path string, body []byte, timestamp string) (string, error)
+}
+
+type responseSigningService struct {
+	secrets    ClientSecretService
+	clients    func() map[string]model.ClientConfig
+	gatewayKey crypto.Signer
+}
+
+// NewResponseSigningService signs proxied responses for clients with
+// response_signature set to "hmac" (their newest active secret) or "gateway"
+// (gatewayKey, which may be nil when no clients use it).
+func NewResponseSigningService(s ClientSecretService, clients func() map[string]model.ClientConfig, gatewayKey crypto.Signer) ResponseSigningService {
+	return &responseSigningService{secrets: s, clients: clients, gatewayKey: gatewayKey}
+}
+
+func (s *responseSigningService) Enabled(clientID string) bool {
+	return s.clients()[clientID].ResponseSignature != ""
+}
+
+// Sign returns the X-SIGNATURE for a response, computed over
+// METHOD:path:sha256(body):timestamp of the partner's request.
+func (s *responseSigningService) Sign(clientID, method, path string, body []byte, timestamp string) (string, error) {
+	stringToSign := fmt.Sprintf("%s:%s:%s:%s", method, path, utils.BodyDigest(body), timestamp)
+
+	switch mode := s.clients()[clientID].ResponseSignature; mode {
+	case "hmac":
+		secrets, err := s.secrets.GetSecrets(clientID)
+		if err != nil {
+			return "", err
+		}
+		if len(secrets) == 0 {
+			return "", errors.New("no client secret to sign response")
+		}
+		return utils.SignHMAC(secrets[0], stringToSign), nil
+	case "gateway":
+		if s.gatewayKey == nil {
+			return "", errors.New("response_signing.private_key_path not configured")
+		}
+		return utils.SignData(s.gatewayKey, stringToSign)
+	default:
+		return "", fmt.Errorf("unknown response_signature %q", mode)
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"api-gateway/model"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrRouteNotFound    = errors.New("no route registered for path")
+	ErrMethodNotAllowed = errors.New("method not allowed for route")
+	ErrTargetNotAllowed = errors.New("target parameter not allowed for route")
+)
+
+type RouteService interface {
+	Match(method, path string) (*model.RouteConfig, error)
+	TargetURL(route *model.RouteConfig, product, path string, query url.Values) (string, error)
+}
+
+type routeService struct {
+	routes         []model.RouteConfig
+	productService ProductService
+}
+
+// NewRouteService sorts the routes so the longest prefix wins on overlap.
+func NewRouteService(routes []model.RouteConfig, p ProductService) RouteService {
+	sorted := make([]model.RouteConfig, len(routes))
+	copy(sorted, routes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].PathPrefix) > len(sorted[j].PathPrefix)
+	})
+	return &routeService{routes: sorted, productService: p}
+}
+
+// Match returns the route registered for path (relative to /secure).
+func (s *routeService) Match(method, path string) (*model.RouteConfig, error) {
+	prefixMatched := false
+	for i := range s.routes {
+		route := &s.routes[i]
+		if !hasPathPrefix(path, route.PathPrefix) {
+			continue
+		}
+		prefixMatched = true
+		if allowsMethod(route, method) {
+			return route, nil
+		}
+	}
+	if prefixMatched {
+		return nil, ErrMethodNotAllowed
+	}
+	return nil, ErrRouteNotFound
+}
+
+// TargetURL builds the upstream URL for path. The legacy ?target= parameter is
+// only honored when the route explicitly allows it.
+func (s *routeService) TargetURL(route *model.RouteConfig, product, path string, query url.Values) (string, error) {
+	if target := query.Get("target"); target != "" {
+		if !route.AllowTarget {
+			return "", ErrTargetNotAllowed
+		}
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", ErrTargetNotAllowed
+		}
+		if len(route.TargetHosts) > 0 && !containsFold(route.TargetHosts, u.Hostname()) {
+			return "", ErrTargetNotAllowed
+		}
+		return u.String(), nil
+	}
+
+	upstream, err := s.upstream(route, product)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return "", fmt.Errorf("invalid upstream for route %s: %w", route.Name, err)
+	}
+
+	rest := path
+	if route.StripPrefix || route.RewritePrefix != "" {
+		rest = route.RewritePrefix + strings.TrimPrefix(path, route.PathPrefix)
+	}
+	u.Path = joinPath(u.Path, rest)
+	u.RawPath = ""
+
+	forwarded := url.Values{}
+	for k, v := range query {
+		if k != "target" {
+			forwarded[k] = v
+		}
+	}
+	u.RawQuery = forwarded.Encode()
+	return u.String(), nil
+}
+
+// upstream returns the base URL for route, looking it up from master_product
+// when the route is product driven.
+func (s *routeService) upstream(route *model.RouteConfig, product string) (string, error) {
+	if !route.FromProduct {
+		if route.Upstream == "" {
+			return "", fmt.Errorf("route %s has no upstream", route.Name)
+		}
+		return route.Upstream, nil
+	}
+	if product == "" {
+		return "", fmt.Errorf("route %s requires a product but the token has none", route.Name)
+	}
+	p, err := s.productService.GetProduct(product)
+	if err != nil {
+		return "", fmt.Errorf("failed to load product %s: %w", product, err)
+	}
+	if p.Path == "" {
+		return "", fmt.Errorf("product %s has no upstream path", product)
+	}
+	return p.Path, nil
+}
+
+// hasPathPrefix matches whole path segments so "/pay" does not match "/payroll".
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func allowsMethod(route *model.RouteConfig, method string) bool {
+	if len(route.Methods) == 0 {
+		return true
+	}
+	return containsFold(route.Methods, method)
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(base, rest string) string {
+	if rest == "" {
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(rest, "/")
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"api-gateway/repository"
+	"api-gateway/utils"
+	"errors"
+	"time"
+)
+
+var (
+	ErrTokenRevoked     = errors.New("token revoked")
+	ErrNotAnAccessToken = errors.New("not an access token")
+)
+
+type TokenService interface {
+	Verify(token string) (*utils.Claims, error)
+	VerifyAccess(token string) (*utils.Claims, error)
+	Revoke(claims *utils.Claims) error
+	RevokeClient(clientID string) error
+}
+
+type tokenService struct {
+	revocations repository.RevocationRepository
+}
+
+func NewTokenService(r repository.RevocationRepository) TokenService {
+	return &tokenService{revocations: r}
+}
+
+// Verify checks the token's signature and time based claims, then rejects it
+// when it or every token of its client was revoked.
+func (s *tokenService) Verify(token string) (*utils.Claims, error) {
+	claims, err := utils.VerifyJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := s.revocations.IsRevoked(claims.ID, claims.Subject, claims.IssuedAt.Time)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// VerifyAccess is Verify restricted to access tokens. It is the check applied
+// to every /secure request and to token introspection.
+func (s *tokenService) VerifyAccess(token string) (*utils.Claims, error) {
+	claims, err := s.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != "" {
+		return nil, ErrNotAnAccessToken
+	}
+	return claims, nil
+}
+
+func (s *tokenService) Revoke(claims *utils.Claims) error {
+	return s.revocations.Revoke(claims.ID, claims.Subject, claims.ExpiresAt.Time)
+}
+
+// RevokeClient kills every token issued to clientID up to now.
+func (s *tokenService) RevokeClient(clientID string) error {
+	return s.revocations.RevokeClient(clientID, time.Now())
+}
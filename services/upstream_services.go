@@ -0,0 +1,171 @@
+package services
+
+import (
+	"api-gateway/model"
+	"api-gateway/utils"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// partnerCredentialHeaders are removed before a request reaches an upstream,
+// unless the route explicitly forwards them.
+var partnerCredentialHeaders = []string{"Authorization", "X-SIGNATURE", "X-TIMESTAMP", "X-CLIENT-KEY", "X-CLIENT-SECRET"}
+
+const (
+	internalTokenTTL       = time.Minute
+	defaultUpstreamTimeout = 30 * time.Second
+	defaultQueueTimeout    = 100 * time.Millisecond
+)
+
+var ErrUpstreamOverloaded = errors.New("upstream overloaded")
+
+type UpstreamService interface {
+	Client(route *model.RouteConfig) (*http.Client, error)
+	Authenticate(req *http.Request, route *model.RouteConfig, claims *utils.Claims, body []byte) error
+	Acquire(ctx context.Context, route *model.RouteConfig, upstream *url.URL) (func(latency time.Duration, failed bool), error)
+}
+
+type upstreamService struct {
+	clients  sync.Map // route name -> *http.Client
+	limiters sync.Map // route name + upstream host -> *utils.ConcurrencyLimiter
+}
+
+func NewUpstreamService() UpstreamService {
+	return &upstreamService{}
+}
+
+// Client returns the HTTP client for route, presenting the configured client
+// certificate when the upstream requires mutual TLS.
+func (s *upstreamService) Client(route *model.RouteConfig) (*http.Client, error) {
+	if client, ok := s.clients.Load(route.Name); ok {
+		return client.(*http.Client), nil
+	}
+
+	timeout := defaultUpstreamTimeout
+	if route.Timeout > 0 {
+		timeout = time.Duration(route.Timeout) * time.Second
+	}
+	client := &http.Client{
+		Timeout: timeout,
+	}
+	if auth := route.UpstreamAuth; auth.ClientCertPath != "" || auth.CAPath != "" {
+		tlsConfig, err := upstreamTLSConfig(auth)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Name, err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
+	}
+
+	actual, _ := s.clients.LoadOrStore(route.Name, client)
+	return actual.(*http.Client), nil
+}
+
+// Acquire takes a concurrency slot for a request from route to upstream,
+// returning ErrUpstreamOverloaded when the upstream is at its limit and the
+// queue is full or waiting took too long. The returned release must be called
+// once the response has been handled.
+func (s *upstreamService) Acquire(ctx context.Context, route *model.RouteConfig, upstream *url.URL) (func(latency time.Duration, failed bool), error) {
+	conf := route.Concurrency
+	if conf.MaxInFlight <= 0 {
+		return func(time.Duration, bool) {}, nil
+	}
+
+	key := route.Name + "|" + upstream.Scheme + "://" + upstream.Host
+	limiter, ok := s.limiters.Load(key)
+	if !ok {
+		queueTimeout := defaultQueueTimeout
+		if conf.QueueTimeoutMs > 0 {
+			queueTimeout = time.Duration(conf.QueueTimeoutMs) * time.Millisecond
+		}
+		limiter, _ = s.limiters.LoadOrStore(key, utils.NewConcurrencyLimiter(conf.MinInFlight, conf.MaxInFlight,
+			conf.MaxQueue, queueTimeout, time.Duration(conf.TargetLatencyMs)*time.Millisecond))
+	}
+
+	l := limiter.(*utils.ConcurrencyLimiter)
+	if err := l.Acquire(ctx); err != nil {
+		if errors.Is(err, utils.ErrLimiterQueueFull) || errors.Is(err, utils.ErrLimiterQueueTimeout) {
+			return nil, fmt.Errorf("%w: %v", ErrUpstreamOverloaded, err)
+		}
+		return nil, err
+	}
+	return l.Release, nil
+}
+
+func upstreamTLSConfig(auth model.UpstreamAuthConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if auth.ClientCertPath != "" {
+		cert, err := tls.LoadX509KeyPair(auth.ClientCertPath, auth.ClientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load upstream client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if auth.CAPath != "" {
+		pem, err := os.ReadFile(auth.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read upstream CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in upstream CA bundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// Authenticate replaces the partner's credentials on req with the gateway's own,
+// according to the route's upstream_auth mode. The default passthrough mode
+// adds none and forwards the partner's only when the route opts in.
+func (s *upstreamService) Authenticate(req *http.Request, route *model.RouteConfig, claims *utils.Claims, body []byte) error {
+	auth := route.UpstreamAuth
+	passthrough := auth.Mode == "" || auth.Mode == "passthrough"
+	if !passthrough || !auth.ForwardPartnerCredentials {
+		for _, h := range partnerCredentialHeaders {
+			req.Header.Del(h)
+		}
+	}
+	// Identify the partner from the verified token, not from what it sent
+	req.Header.Set("X-PARTNER-ID", claims.Subject)
+	req.Header.Set("X-PRODUCT-ID", claims.Product)
+
+	switch auth.Mode {
+	case "", "passthrough":
+	case "jwt":
+		audience := auth.Audience
+		if audience == "" {
+			audience = route.Name
+		}
+		token, err := utils.GenerateInternalJWT(claims, audience, internalTokenTTL)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case "hmac":
+		if auth.Secret == "" {
+			return fmt.Errorf("route %s: upstream_auth.secret is required for hmac", route.Name)
+		}
+		timestamp := time.Now().Format(utils.TimestampLayout)
+		stringToSign := fmt.Sprintf("%s:%s:%s:%s", req.Method, req.URL.EscapedPath(), utils.BodyDigest(body), timestamp)
+		req.Header.Set("X-TIMESTAMP", timestamp)
+		req.Header.Set("X-SIGNATURE", utils.SignHMAC(auth.Secret, stringToSign))
+	case "mtls":
+		// The client certificate set up in Client authenticates the gateway
+		if auth.ClientCertPath == "" {
+			return fmt.Errorf("route %s: upstream_auth.client_cert_path is required for mtls", route.Name)
+		}
+	default:
+		return fmt.Errorf("route %s: unknown upstream_auth mode %q", route.Name, auth.Mode)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLimiterQueueFull    = errors.New("too many requests waiting for the upstream")
+	ErrLimiterQueueTimeout = errors.New("timed out waiting for the upstream")
+)
+
+// ConcurrencyLimiter caps the requests in flight to one upstream. Requests over
+// the limit wait in a bounded FIFO queue for at most the queue timeout.
+//
+// With a target latency the limit adapts between min and max: every request
+// answered within the target raises it by 1/limit, every slower or failed one
+// lowers it by 10%, so a degrading upstream gets fewer concurrent requests.
+type ConcurrencyLimiter struct {
+	mu           sync.Mutex
+	limit        float64
+	min, max     float64
+	inFlight     int
+	waiters      []chan struct{}
+	maxQueue     int
+	queueTimeout time.Duration
+	target       time.Duration
+}
+
+// NewConcurrencyLimiter starts at maxLimit requests in flight. A zero target
+// disables adaptation.
+func NewConcurrencyLimiter(minLimit, maxLimit, maxQueue int, queueTimeout, target time.Duration) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		limit:        float64(maxLimit),
+		min:          float64(max(min(minLimit, maxLimit), 1)),
+		max:          float64(maxLimit),
+		maxQueue:     maxQueue,
+		queueTimeout: queueTimeout,
+		target:       target,
+	}
+}
+
+// Acquire takes a slot, waiting in the queue when none is free. Every nil
+// return must be paired with one Release.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.inFlight < l.currentLimit() && len(l.waiters) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return nil
+	}
+	if len(l.waiters) >= l.maxQueue {
+		l.mu.Unlock()
+		return ErrLimiterQueueFull
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-timer.C:
+		err = ErrLimiterQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, w := range l.waiters {
+		if w == ready {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return err
+		}
+	}
+	// Granted a slot while giving up; hand it on
+	l.inFlight--
+	l.grant()
+	return err
+}
+
+// Release frees the slot of a request that took latency to answer, or failed.
+func (l *ConcurrencyLimiter) Release(latency time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.target > 0 {
+		if failed || latency > l.target {
+			l.limit = math.Max(l.min, l.limit*0.9)
+		} else {
+			l.limit = math.Min(l.max, l.limit+1/l.limit)
+		}
+	}
+	l.inFlight--
+	l.grant()
+}
+
+// Limit is the number of requests currently allowed in flight.
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.currentLimit()
+}
+
+// currentLimit callers hold l.mu.
+func (l *ConcurrencyLimiter) currentLimit() int {
+	return int(l.limit)
+}
+
+// grant wakes queued requests while slots are free. Callers hold l.mu.
+func (l *ConcurrencyLimiter) grant() {
+	for len(l.waiters) > 0 && l.inFlight < l.currentLimit() {
+		l.inFlight++
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+	}
+}
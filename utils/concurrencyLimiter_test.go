@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterQueue(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxQueue int
+		timeout  time.Duration
+		cancel   bool
+		want     error
+	}{
+		{"no queue sheds at once", 0, time.Second, false, ErrLimiterQueueFull},
+		{"queued request times out", 1, 10 * time.Millisecond, false, ErrLimiterQueueTimeout},
+		{"queued request gives up with its context", 1, time.Second, true, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewConcurrencyLimiter(1, 1, tt.maxQueue, tt.timeout, 0)
+			if err := l.Acquire(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				time.AfterFunc(10*time.Millisecond, cancel)
+			}
+			if err := l.Acquire(ctx); !errors.Is(err, tt.want) {
+				t.Fatalf("Acquire() = %v, want %v", err, tt.want)
+			}
+
+			// The waiter left the queue, so the freed slot is available
+			l.Release(0, false)
+			if err := l.Acquire(context.Background()); err != nil {
+				t.Fatalf("Acquire() after release = %v", err)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiterHandOff(t *testing.T) {
+	l := NewConcurrencyLimiter(1, 1, 2, time.Second, 0)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan int, 2)
+	for i := 1; i <= 2; i++ {
+		go func() {
+			if err := l.Acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+		}()
+		// Queue the waiters in a known order
+		for {
+			l.mu.Lock()
+			queued := len(l.waiters)
+			l.mu.Unlock()
+			if queued == i {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	for want := 1; want <= 2; want++ {
+		l.Release(0, false)
+		if got := <-order; got != want {
+			t.Fatalf("slot handed to waiter %d, want %d", got, want)
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight != 1 || len(l.waiters) != 0 {
+		t.Fatalf("inFlight = %d, waiters = %d after hand-off", l.inFlight, len(l.waiters))
+	}
+}
+
+func TestConcurrencyLimiterAdapts(t *testing.T) {
+	l := NewConcurrencyLimiter(2, 10, 0, time.Second, 100*time.Millisecond)
+	for i := 0; i < 30; i++ {
+		if err := l.Acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		l.Release(time.Second, false)
+	}
+	if got := l.Limit(); got != 2 {
+		t.Fatalf("Limit() after slow responses = %d, want the floor 2", got)
+	}
+
+	for i := 0; i < 200; i++ {
+		if err := l.Acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		l.Release(time.Millisecond, false)
+	}
+	if got := l.Limit(); got != 10 {
+		t.Fatalf("Limit() after fast responses = %d, want the ceiling 10", got)
+	}
+
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l.Release(time.Millisecond, true)
+	if got := l.Limit(); got != 9 {
+		t.Fatalf("Limit() after a failure = %d, want 9", got)
+	}
+}
@@ -0,0 +1,316 @@
+package utils
+
+import (
+	"api-gateway/model"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrClientKeyNotFound      = errors.New("no public key registered for client")
+	ErrCertificateExpired     = errors.New("client certificate expired")
+	ErrCertificateNotYetValid = errors.New("client certificate not yet valid")
+)
+
+// ClientKey is a parsed client public key with the settings needed to verify
+// the client's signatures. Keys configured as an X.509 certificate also carry
+// the certificate and, when a CA bundle is configured, the pool it must chain to.
+type ClientKey struct {
+	ClientID    string
+	Path        string
+	PublicKey   crypto.PublicKey
+	Certificate *x509.Certificate
+	Roots       *x509.CertPool
+	Options     SignatureOptions
+	Config      model.ClientConfig
+	Fingerprint string // hex SHA-256 of the DER encoded SubjectPublicKeyInfo
+	LoadedAt    time.Time
+	keyStamp    fileStamp
+	caStamp     fileStamp
+}
+
+// CheckCertificate rejects expired, not yet valid and untrusted certificates.
+// Bare public keys have no validity period and always pass. Without a CA
+// bundle the configured certificate is pinned and only its dates are checked.
+func (k *ClientKey) CheckCertificate(now time.Time) error {
+	if k.Certificate == nil {
+		return nil
+	}
+	if now.Before(k.Certificate.NotBefore) {
+		return ErrCertificateNotYetValid
+	}
+	if now.After(k.Certificate.NotAfter) {
+		return ErrCertificateExpired
+	}
+	if k.Roots != nil {
+		_, err := k.Certificate.Verify(x509.VerifyOptions{
+			Roots:       k.Roots,
+			CurrentTime: now,
+			KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return fmt.Errorf("client certificate not trusted: %w", err)
+		}
+	}
+	return nil
+}
+
+// ClientKeyStatus describes one client key for operators.
+type ClientKeyStatus struct {
+	ClientID    string     `json:"clientId"`
+	Path        string     `json:"path"`
+	Fingerprint string     `json:"fingerprint,omitempty"`
+	NotAfter    *time.Time `json:"notAfter,omitempty"`
+	LoadedAt    *time.Time `json:"loadedAt,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// KeyRegistry parses client public keys once and keeps them in memory. The
+// clients function is consulted on every refresh so keys follow config reloads.
+type KeyRegistry struct {
+	mu         sync.RWMutex
+	clients    func() map[string]model.ClientConfig
+	keys       map[string]*ClientKey
+	errs       map[string]error
+	warnWithin time.Duration
+	warned     map[string]time.Time // client -> last expiry warning
+}
+
+// NewKeyRegistry warns about client certificates expiring within warnWithin.
+func NewKeyRegistry(clients func() map[string]model.ClientConfig, warnWithin time.Duration) *KeyRegistry {
+	return &KeyRegistry{
+		clients:    clients,
+		keys:       map[string]*ClientKey{},
+		errs:       map[string]error{},
+		warnWithin: warnWithin,
+		warned:     map[string]time.Time{},
+	}
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func stampFile(path string) (fileStamp, error) {
+	if path == "" {
+		return fileStamp{}, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// keyPath is the file holding the client's key: its certificate when
+// configured. Keys stored as PEM in the clients table have no file.
+func keyPath(conf model.ClientConfig) string {
+	if conf.PublicKeyPEM != "" {
+		return ""
+	}
+	if conf.CertificatePath != "" {
+		return conf.CertificatePath
+	}
+	return conf.PublicKeyPath
+}
+
+// Refresh loads keys of new clients and reloads those whose file changed. It
+// returns the clients whose key could not be loaded; a key that fails to
+// reload keeps serving its previous version.
+func (r *KeyRegistry) Refresh() map[string]error {
+	clients := r.clients()
+
+	r.mu.RLock()
+	current := r.keys
+	r.mu.RUnlock()
+
+	keys := make(map[string]*ClientKey, len(clients))
+	errs := map[string]error{}
+	for clientID, conf := range clients {
+		path := keyPath(conf)
+		if path == "" && conf.PublicKeyPEM == "" {
+			continue
+		}
+		old := current[clientID]
+		keyStamp, err := stampFile(path)
+		var caStamp fileStamp
+		if err == nil {
+			caStamp, err = stampFile(conf.CABundlePath)
+		}
+		if err == nil && old != nil && old.Path == path && old.Config.PublicKeyPEM == conf.PublicKeyPEM && old.Config.CABundlePath == conf.CABundlePath &&
+			old.Config.SignatureAlgorithm == conf.SignatureAlgorithm && old.Config.SignatureHash == conf.SignatureHash &&
+			old.keyStamp == keyStamp && old.caStamp == caStamp {
+			unchanged := *old
+			unchanged.Config = conf
+			keys[clientID] = &unchanged
+			continue
+		}
+		if err == nil {
+			var key *ClientKey
+			key, err = loadClientKey(clientID, conf)
+			if err == nil {
+				key.keyStamp, key.caStamp = keyStamp, caStamp
+				if old != nil && old.Fingerprint != key.Fingerprint {
+					log.Printf("Public key of client %s changed, fingerprint %s", clientID, key.Fingerprint)
+				}
+				keys[clientID] = key
+				continue
+			}
+		}
+		errs[clientID] = err
+		if old != nil && old.Path == path {
+			keys[clientID] = old
+		}
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.errs = errs
+	r.mu.Unlock()
+	return errs
+}
+
+// Watch refreshes the registry every interval, logging keys that fail to load
+// and certificates about to expire.
+func (r *KeyRegistry) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for clientID, err := range r.Refresh() {
+				log.Printf("Failed to load public key of client %s: %v", clientID, err)
+			}
+			r.WarnExpiring(time.Now())
+		}
+	}()
+}
+
+// WarnExpiring logs, at most daily per client, certificates that expire
+// within the warning window or already have.
+func (r *KeyRegistry) WarnExpiring(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for clientID, key := range r.keys {
+		if key.Certificate == nil || key.Certificate.NotAfter.Sub(now) > r.warnWithin {
+			continue
+		}
+		if last, ok := r.warned[clientID]; ok && now.Sub(last) < 24*time.Hour {
+			continue
+		}
+		r.warned[clientID] = now
+		if now.After(key.Certificate.NotAfter) {
+			log.Printf("WARNING: certificate of client %s expired on %s", clientID, key.Certificate.NotAfter.Format(time.RFC3339))
+		} else {
+			log.Printf("WARNING: certificate of client %s expires on %s", clientID, key.Certificate.NotAfter.Format(time.RFC3339))
+		}
+	}
+}
+
+// Get returns the parsed key of clientID.
+func (r *KeyRegistry) Get(clientID string) (*ClientKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if key, ok := r.keys[clientID]; ok {
+		return key, nil
+	}
+	if err, ok := r.errs[clientID]; ok {
+		return nil, err
+	}
+	return nil, ErrClientKeyNotFound
+}
+
+// Status lists every configured client key with its fingerprint or load error.
+func (r *KeyRegistry) Status() []ClientKeyStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var status []ClientKeyStatus
+	for clientID, key := range r.keys {
+		loadedAt := key.LoadedAt
+		s := ClientKeyStatus{ClientID: clientID, Path: key.Path, Fingerprint: key.Fingerprint, LoadedAt: &loadedAt}
+		if key.Certificate != nil {
+			notAfter := key.Certificate.NotAfter
+			s.NotAfter = &notAfter
+		}
+		if err, ok := r.errs[clientID]; ok {
+			s.Error = err.Error()
+		}
+		status = append(status, s)
+	}
+	for clientID, err := range r.errs {
+		if _, ok := r.keys[clientID]; !ok {
+			status = append(status, ClientKeyStatus{ClientID: clientID, Error: err.Error()})
+		}
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].ClientID < status[j].ClientID })
+	return status
+}
+
+func loadClientKey(clientID string, conf model.ClientConfig) (*ClientKey, error) {
+	opts, err := ParseSignatureOptions(conf.SignatureAlgorithm, conf.SignatureHash)
+	if err != nil {
+		return nil, err
+	}
+	key := &ClientKey{ClientID: clientID, Path: keyPath(conf), Options: opts, Config: conf, LoadedAt: time.Now()}
+
+	switch {
+	case conf.PublicKeyPEM != "" && IsCertificatePEM([]byte(conf.PublicKeyPEM)):
+		key.Certificate, err = ParseCertificatePEM([]byte(conf.PublicKeyPEM))
+	case conf.PublicKeyPEM != "":
+		key.PublicKey, err = ParsePublicKeyPEM([]byte(conf.PublicKeyPEM))
+	case conf.CertificatePath != "":
+		key.Certificate, err = LoadCertificate(conf.CertificatePath)
+	default:
+		key.PublicKey, err = LoadPublicKey(conf.PublicKeyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Certificate != nil {
+		if _, err := checkPublicKey(key.Certificate.PublicKey); err != nil {
+			return nil, err
+		}
+		key.PublicKey = key.Certificate.PublicKey
+		if conf.CABundlePath != "" {
+			key.Roots, err = LoadCertPool(conf.CABundlePath)
+			if err != nil {
+				return nil, err
+			}
+			// Surface chain problems at load time; dates are checked per login
+			_, err = key.Certificate.Verify(x509.VerifyOptions{
+				Roots:       key.Roots,
+				CurrentTime: key.Certificate.NotBefore.Add(time.Second),
+				KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("client certificate not trusted: %w", err)
+			}
+		}
+	}
+
+	key.Fingerprint, err = KeyFingerprint(key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// KeyFingerprint is the hex SHA-256 of the key's DER encoded SubjectPublicKeyInfo.
+func KeyFingerprint(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestParsePublicKeyPEMCurves(t *testing.T) {
+	tests := []struct {
+		curve elliptic.Curve
+		ok    bool
+	}{
+		{elliptic.P224(), false},
+		{elliptic.P256(), true},
+		{elliptic.P384(), true},
+		{elliptic.P521(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.curve.Params().Name, func(t *testing.T) {
+			key, err := ecdsa.GenerateKey(tt.curve, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+			if (err == nil) != tt.ok {
+				t.Fatalf("ParsePublicKeyPEM() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSignDataVerifies(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, key := range map[string]crypto.Signer{"RSA": rsaKey, "ECDSA": ecKey, "Ed25519": edKey} {
+		t.Run(name, func(t *testing.T) {
+			signature, err := SignData(key, "payload")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifySignatureWith(key.Public(), DefaultSignatureOptions, "payload", signature); err != nil {
+				t.Fatalf("VerifySignatureWith() = %v", err)
+			}
+		})
+	}
+}
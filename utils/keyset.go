@@ -0,0 +1,238 @@
+package utils
+
+import (
+	"api-gateway/model"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtKeySpec is one signing or verification key of the gateway.
+type jwtKeySpec struct {
+	kid     string
+	method  jwt.SigningMethod
+	signKey interface{} // nil for verify-only keys
+	public  interface{}
+}
+
+// SigningKeys is a loaded and checked set of gateway token keys.
+type SigningKeys struct {
+	signing *jwtKeySpec
+	byKid   map[string]*jwtKeySpec
+	methods []string
+}
+
+var jwtKeys atomic.Pointer[SigningKeys]
+
+// LoadSigningKeys replaces the gateway's token keys. The key marked active signs
+// new tokens; every other configured key keeps verifying tokens it signed until
+// it is removed from the config. Safe to call while requests are in flight.
+func LoadSigningKeys(cfg model.JWTConfig) error {
+	set, err := ParseSigningKeys(cfg)
+	if err != nil {
+		return err
+	}
+	UseSigningKeys(set)
+	return nil
+}
+
+// UseSigningKeys switches to keys returned by ParseSigningKeys.
+func UseSigningKeys(set *SigningKeys) {
+	jwtKeys.Store(set)
+}
+
+// ParseSigningKeys loads and checks the keys of cfg without using them, so a
+// reload can validate them before changing anything.
+func ParseSigningKeys(cfg model.JWTConfig) (*SigningKeys, error) {
+	set := &SigningKeys{byKid: map[string]*jwtKeySpec{}}
+
+	for _, kc := range cfg.Keys {
+		spec, err := loadKeySpec(kc)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", kc.KID, err)
+		}
+		if _, dup := set.byKid[spec.kid]; dup {
+			return nil, fmt.Errorf("jwt key %s: duplicate kid", kc.KID)
+		}
+		set.byKid[spec.kid] = spec
+		if kc.Active {
+			if set.signing != nil {
+				return nil, errors.New("more than one active jwt key")
+			}
+			if spec.signKey == nil {
+				return nil, fmt.Errorf("jwt key %s: active key needs a private key", kc.KID)
+			}
+			set.signing = spec
+		}
+	}
+
+	if len(cfg.Keys) == 0 {
+		// Legacy shared secret, only used when no asymmetric keys are configured
+		if cfg.Secret == "" {
+			return nil, errors.New("no jwt keys or secret configured")
+		}
+		spec := &jwtKeySpec{method: jwt.SigningMethodHS256, signKey: []byte(cfg.Secret), public: []byte(cfg.Secret)}
+		set.byKid[""] = spec
+		set.signing = spec
+	}
+	if set.signing == nil {
+		return nil, errors.New("no active jwt key configured")
+	}
+
+	seen := map[string]bool{}
+	for _, spec := range set.byKid {
+		if alg := spec.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			set.methods = append(set.methods, alg)
+		}
+	}
+
+	return set, nil
+}
+
+func loadKeySpec(kc model.JWTKeyConfig) (*jwtKeySpec, error) {
+	if kc.KID == "" {
+		return nil, errors.New("kid is required")
+	}
+	method := jwt.GetSigningMethod(kc.Algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported algorithm %q", kc.Algorithm)
+	}
+	spec := &jwtKeySpec{kid: kc.KID, method: method}
+
+	if kc.PrivateKeyPath != "" {
+		signer, err := LoadPrivateKey(kc.PrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		spec.signKey = signer
+		spec.public = signer.Public()
+	}
+	if kc.PublicKeyPath != "" {
+		public, err := LoadPublicKey(kc.PublicKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		spec.public = public
+	}
+	if spec.public == nil {
+		return nil, errors.New("private_key_path or public_key_path is required")
+	}
+	if err := checkKeyAlgorithm(kc.Algorithm, spec.public); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// checkKeyAlgorithm makes sure the key type and curve match the JWS algorithm.
+func checkKeyAlgorithm(alg string, public crypto.PublicKey) error {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		curves := map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}
+		if curve, ok := curves[alg]; ok && curve == key.Curve {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if alg == "EdDSA" {
+			return nil
+		}
+	}
+	return fmt.Errorf("key type does not match algorithm %s", alg)
+}
+
+func currentKeys() (*SigningKeys, error) {
+	set := jwtKeys.Load()
+	if set == nil {
+		return nil, errors.New("jwt keys not loaded")
+	}
+	return set, nil
+}
+
+func signToken(claims jwt.Claims) (string, error) {
+	set, err := currentKeys()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(set.signing.method, claims)
+	if set.signing.kid != "" {
+		token.Header["kid"] = set.signing.kid
+	}
+	return token.SignedString(set.signing.signKey)
+}
+
+// verificationKey is the jwt.Keyfunc selecting the key named by the token's kid.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	set, err := currentKeys()
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := token.Header["kid"].(string)
+	spec, ok := set.byKid[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != spec.method.Alg() {
+		return nil, fmt.Errorf("algorithm %s not allowed for key %q", token.Method.Alg(), kid)
+	}
+	return spec.public, nil
+}
+
+func validMethods() []string {
+	set, err := currentKeys()
+	if err != nil {
+		return nil
+	}
+	return set.methods
+}
+
+// JWKS returns the public verification keys as a JSON Web Key Set (RFC 7517).
+// Shared secrets are never published.
+func JWKS() map[string]interface{} {
+	keys := []map[string]string{}
+	if set, err := currentKeys(); err == nil {
+		for _, spec := range set.byKid {
+			if jwk := publicJWK(spec); jwk != nil {
+				keys = append(keys, jwk)
+			}
+		}
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+func publicJWK(spec *jwtKeySpec) map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := map[string]string{"kid": spec.kid, "alg": spec.method.Alg(), "use": "sig"}
+	switch key := spec.public.(type) {
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = b64(key.N.Bytes())
+		jwk["e"] = b64(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk["kty"] = "EC"
+		jwk["crv"] = key.Curve.Params().Name
+		jwk["x"] = b64(key.X.FillBytes(make([]byte, size)))
+		jwk["y"] = b64(key.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = "Ed25519"
+		jwk["x"] = b64(key)
+	default:
+		return nil
+	}
+	return jwk
+}
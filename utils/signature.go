@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// BodyDigest is the lowercase hex SHA-256 of the minified body, as used in
+// transaction strings-to-sign.
+func BodyDigest(body []byte) string {
+	bodyHash := sha256.Sum256([]byte(minifyJSON(body)))
+	return strings.ToLower(hex.EncodeToString(bodyHash[:]))
+}
+
+// SignHMAC returns base64(HMAC-SHA512(secret, stringToSign)).
+func SignHMAC(secret, stringToSign string) string {
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignData returns a base64 encoded SHA-256 signature over data, the
+// counterpart of VerifySignatureWith with DefaultSignatureOptions. Ed25519
+// keys sign data itself.
+func SignData(signer crypto.Signer, data string) (string, error) {
+	hashed := sha256.Sum256([]byte(data))
+	var signature []byte
+	var err error
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	case *ecdsa.PrivateKey:
+		signature, err = ecdsa.SignASN1(rand.Reader, key, hashed[:])
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, []byte(data))
+	default:
+		return "", errors.New("unsupported private key type")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to sign data: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// SignatureOptions selects how a client signs. The signature scheme follows
+// the key type: RSA uses Padding, ECDSA and Ed25519 have a single scheme.
+type SignatureOptions struct {
+	Padding string      // "PKCS1v15" or "PSS", RSA only
+	Hash    crypto.Hash // Ignored for Ed25519, which signs the message itself
+}
+
+// DefaultSignatureOptions is RSA PKCS#1 v1.5 with SHA-256.
+var DefaultSignatureOptions = SignatureOptions{Padding: "PKCS1v15", Hash: crypto.SHA256}
+
+// ParseSignatureOptions reads the signature_algorithm and signature_hash client
+// settings; empty values keep the defaults.
+func ParseSignatureOptions(padding, hash string) (SignatureOptions, error) {
+	opts := DefaultSignatureOptions
+	switch strings.ToUpper(padding) {
+	case "":
+	case "PKCS1V15":
+		opts.Padding = "PKCS1v15"
+	case "PSS":
+		opts.Padding = "PSS"
+	default:
+		return opts, fmt.Errorf("unsupported signature algorithm %q", padding)
+	}
+	switch strings.ToUpper(strings.ReplaceAll(hash, "-", "")) {
+	case "", "SHA256":
+	case "SHA384":
+		opts.Hash = crypto.SHA384
+	case "SHA512":
+		opts.Hash = crypto.SHA512
+	default:
+		return opts, fmt.Errorf("unsupported signature hash %q", hash)
+	}
+	return opts, nil
+}
+
+// VerifySignatureWith checks a base64 encoded signature over data. The verifier
+// is chosen from the key type: RSA PKCS#1 v1.5 or PSS, ECDSA (ASN.1 or raw r||s)
+// or Ed25519.
+func VerifySignatureWith(publicKey crypto.PublicKey, opts SignatureOptions, data, base64Signature string) error {
+	signature, err := base64.StdEncoding.DecodeString(base64Signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode base64 signature: %w", err)
+	}
+
+	if key, ok := publicKey.(ed25519.PublicKey); ok {
+		if !ed25519.Verify(key, []byte(data), signature) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	}
+
+	h := opts.Hash.New()
+	h.Write([]byte(data))
+	hashed := h.Sum(nil)
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if opts.Padding == "PSS" {
+			err = rsa.VerifyPSS(key, opts.Hash, hashed, signature, nil)
+		} else {
+			err = rsa.VerifyPKCS1v15(key, opts.Hash, hashed, signature)
+		}
+	case *ecdsa.PublicKey:
+		if !verifyECDSA(key, hashed, signature) {
+			err = errors.New("invalid ecdsa signature")
+		}
+	default:
+		return errors.New("unsupported public key type")
+	}
+	if err != nil {
+		// This error means the signature is invalid or tampered with.
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
+
+// verifyECDSA accepts ASN.1 DER signatures and the fixed size r||s form some
+// HSMs and JOSE libraries produce.
+func verifyECDSA(key *ecdsa.PublicKey, hashed, signature []byte) bool {
+	if ecdsa.VerifyASN1(key, hashed, signature) {
+		return true
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	if len(signature) != 2*size {
+		return false
+	}
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+	return ecdsa.Verify(key, hashed, r, s)
+}
+
+func minifyJSON(jsonBytes []byte) string {
+	buffer := new(bytes.Buffer)
+	if err := json.Compact(buffer, jsonBytes); err != nil {
+		s := string(jsonBytes)
+		s = strings.ReplaceAll(s, " ", "")
+		s = strings.ReplaceAll(s, "\n", "")
+		s = strings.ReplaceAll(s, "\r", "")
+		s = strings.ReplaceAll(s, "\t", "")
+		return s
+	}
+	return buffer.String()
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"errors"
+	"time"
+)
+
+// TimestampLayout is the X-TIMESTAMP format, e.g. 2025-06-18T17:43:05+07:00.
+const TimestampLayout = "2006-01-02T15:04:05-07:00"
+
+// TimestampWindow is how far X-TIMESTAMP may drift from the gateway clock.
+const TimestampWindow = 5 * time.Minute
+
+var ErrTimestampOutOfWindow = errors.New("request timestamp is too old or too far in the future")
+
+// ParseTimestamp parses an X-TIMESTAMP header and checks it is within
+// TimestampWindow of now. Format errors are returned as parse errors.
+func ParseTimestamp(value string) (time.Time, error) {
+	t, err := time.Parse(TimestampLayout, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if time.Since(t).Abs() > TimestampWindow {
+		return time.Time{}, ErrTimestampOutOfWindow
+	}
+	return t, nil
+}
+
+// ReplayWindowEnd is when an X-EXTERNAL-ID used at now may be reused: external
+// IDs must be unique per client per day, so reservations last until midnight.
+func ReplayWindowEnd(now time.Time) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+}
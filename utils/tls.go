@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"api-gateway/model"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+type tlsState struct {
+	conf     model.TLSConfig
+	cert     *tls.Certificate
+	notAfter time.Time
+	config   *tls.Config
+	stamps   [3]fileStamp // cert, key, client CA
+}
+
+// TLSReloader serves the listener's certificate and client CA pool and swaps
+// them when their files change, so rotating a certificate never needs a
+// restart. Handshakes in progress keep the state they started with.
+type TLSReloader struct {
+	conf  func() model.TLSConfig
+	state atomic.Pointer[tlsState]
+}
+
+// NewTLSReloader loads the initial certificate; the conf function is consulted
+// on every reload so paths follow config reloads.
+func NewTLSReloader(conf func() model.TLSConfig) (*TLSReloader, error) {
+	r := &TLSReloader{conf: conf}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate, key and client CA pool again. On failure the
+// current ones stay active.
+func (r *TLSReloader) Reload() error {
+	state, err := loadTLSState(r.conf())
+	if err != nil {
+		return err
+	}
+	r.state.Store(state)
+	return nil
+}
+
+// Watch reloads whenever one of the files changes on disk.
+func (r *TLSReloader) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			current := r.state.Load()
+			conf := r.conf()
+			stamps, err := tlsStamps(conf)
+			if err != nil || (stamps == current.stamps && conf == current.conf) {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Printf("TLS certificate reload failed, keeping current certificate: %v", err)
+				continue
+			}
+			log.Printf("TLS certificate reloaded, valid until %s", r.NotAfter().Format(time.RFC3339))
+		}
+	}()
+}
+
+// NotAfter is the expiry of the certificate currently served.
+func (r *TLSReloader) NotAfter() time.Time {
+	return r.state.Load().notAfter
+}
+
+// TLSConfig returns the listener configuration. Every handshake picks up the
+// latest certificate and client CA pool through GetConfigForClient.
+func (r *TLSReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.state.Load().cert, nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.state.Load().config, nil
+		},
+	}
+}
+
+func tlsStamps(conf model.TLSConfig) ([3]fileStamp, error) {
+	var stamps [3]fileStamp
+	var err error
+	for i, path := range []string{conf.CertPath, conf.KeyPath, conf.ClientCAPath} {
+		if stamps[i], err = stampFile(path); err != nil {
+			return stamps, err
+		}
+	}
+	return stamps, nil
+}
+
+// loadTLSState builds the per-handshake settings: TLS 1.2 or newer and,
+// depending on client_auth, requesting or requiring a client certificate that
+// chains to client_ca_path.
+func loadTLSState(conf model.TLSConfig) (*tlsState, error) {
+	stamps, err := tlsStamps(conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat TLS files: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(conf.CertPath, conf.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("failed to parse server certificate: %w", err)
+		}
+	}
+	state := &tlsState{
+		conf:     conf,
+		cert:     &cert,
+		notAfter: leaf.NotAfter,
+		stamps:   stamps,
+		config: &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		},
+	}
+
+	switch conf.ClientAuth {
+	case "", "none":
+		return state, nil
+	case "optional":
+		state.config.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		state.config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown tls client_auth %q", conf.ClientAuth)
+	}
+	state.config.ClientCAs, err = LoadCertPool(conf.ClientCAPath)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
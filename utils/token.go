@@ -1,44 +1,150 @@
 package utils
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-var jwtKey = []byte("mysecret")
+// jwtIdentity is the issuer and audience of tokens, swapped whole on reload.
+type jwtIdentity struct {
+	issuer   string
+	audience []string
+}
+
+var identity atomic.Pointer[jwtIdentity]
+
+func init() {
+	identity.Store(&jwtIdentity{issuer: "api-gateway", audience: []string{"api-gateway"}})
+}
+
+// ClaimsKey is the gin context key JWTAuthMiddleware stores verified claims under.
+const ClaimsKey = "claims"
+
+// Claims is the payload of every token issued by the gateway.
+type Claims struct {
+	Product    string   `json:"product,omitempty"`
+	ExternalID string   `json:"external_id,omitempty"`
+	Scopes     []string `json:"scopes,omitempty"`
+	Type       string   `json:"type,omitempty"`   // "refresh", "internal" or empty for access tokens
+	Family     string   `json:"family,omitempty"` // Shared by refresh tokens rotated from one login
+	jwt.RegisteredClaims
+}
+
+// HasScope reports whether the token was granted scope.
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigureJWT sets the issuer and audience written into and required from tokens.
+func ConfigureJWT(issuer string, audience []string) {
+	next := *identity.Load()
+	if issuer != "" {
+		next.issuer = issuer
+	}
+	if len(audience) > 0 {
+		next.audience = audience
+	}
+	identity.Store(&next)
+}
+
+func newClaims(sub, product string, ttl time.Duration) Claims {
+	now := time.Now()
+	id := identity.Load()
+	return Claims{
+		Product: product,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    id.issuer,
+			Subject:   sub,
+			Audience:  id.audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+}
+
+// GenerateJWT issues an access token valid for ttl, returning its claims so the
+// caller can report the real expiry.
+func GenerateJWT(sub, product, externalID string, scopes []string, ttl time.Duration) (string, *Claims, error) {
+	claims := newClaims(sub, product, ttl)
+	claims.ExternalID = externalID
+	claims.Scopes = scopes
+	token, err := signToken(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &claims, nil
+}
 
-func GenerateJWT(sub string) (string, error) {
-	claims := jwt.MapClaims{
-		"sub": sub,
-		"exp": time.Now().Add(time.Hour * 1).Unix(),
+// GenerateRefreshJWT issues a refresh token in family, returning its claims so
+// the caller can record the jti. An empty family starts a new one.
+func GenerateRefreshJWT(sub, product, family string, ttl time.Duration) (string, *Claims, error) {
+	claims := newClaims(sub, product, ttl)
+	claims.Type = "refresh"
+	claims.Family = family
+	if claims.Family == "" {
+		claims.Family = uuid.New().String()
+	}
+	token, err := signToken(claims)
+	if err != nil {
+		return "", nil, err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return token, &claims, nil
 }
 
-func GenerateRefreshJWT(sub string) (string, error) {
-	claims := jwt.MapClaims{
-		"sub":  sub,
-		"exp":  time.Now().Add(7 * 24 * time.Hour).Unix(), // refresh token valid 7 hari
-		"type": "refresh",
+// GenerateInternalJWT issues a short lived token the gateway presents to an
+// upstream on behalf of the partner in claims. It is typed "internal" so the
+// gateway never accepts it as an access token.
+func GenerateInternalJWT(partner *Claims, audience string, ttl time.Duration) (string, error) {
+	claims := newClaims(partner.Subject, partner.Product, ttl)
+	claims.Audience = jwt.ClaimStrings{audience}
+	claims.ExternalID = partner.ExternalID
+	claims.Scopes = partner.Scopes
+	claims.Type = "internal"
+	return signToken(claims)
+}
+
+// VerifyJWT checks the signature, issuer, audience and time based claims of tokenStr.
+func VerifyJWT(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	id := identity.Load()
+	_, err := jwt.ParseWithClaims(tokenStr, claims, verificationKey,
+		jwt.WithValidMethods(validMethods()),
+		jwt.WithIssuer(id.issuer),
+		jwt.WithAudience(id.audience[0]),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return claims, nil
 }
 
-func VerifyJWT(tokenStr string) (*jwt.Token, error) {
-	return jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+// Lifetime is the validity period the token was issued with.
+func (c *Claims) Lifetime() time.Duration {
+	if c.ExpiresAt == nil || c.IssuedAt == nil {
+		return 0
+	}
+	return c.ExpiresAt.Sub(c.IssuedAt.Time)
 }
 
-func ExtractClaims(c *gin.Context) (jwt.MapClaims, error) {
-	tokenStr := c.GetHeader("Authorization")
-	token, err := VerifyJWT(tokenStr)
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
+// GetClaims returns the claims JWTAuthMiddleware verified for this request.
+func GetClaims(c *gin.Context) (*Claims, bool) {
+	value, ok := c.Get(ClaimsKey)
+	if !ok {
+		return nil, false
 	}
-	return nil, err
+	claims, ok := value.(*Claims)
+	return claims, ok
 }